@@ -2,22 +2,15 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
-	"os"
 	"path/filepath"
-	"runtime"
-	"strings"
 	"time"
 
 	"github.com/diamondburned/go-fanbox/fanbox"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/pkg/errors"
-	"golang.org/x/sync/semaphore"
 )
 
 type Config struct {
@@ -39,6 +32,52 @@ type Config struct {
 	// ALLOW_FILE_EXTS is the list of allowed file extensions without the
 	// trailing dot for all files. This does not include images.
 	AllowFileExts CommaWords `default:"gif,mp4" split_words:"true"`
+	// ALLOW_ANIMATIONS also downloads files that are videos or animated
+	// images, regardless of ALLOW_FILE_EXTS.
+	AllowAnimations bool `default:"false" split_words:"true"`
+	// DEDUP skips downloading files that were already downloaded as part of
+	// another post during this run.
+	Dedup bool `default:"false"`
+	// STATE_FILE is the path to the JSON file that keeps track of fully
+	// downloaded posts. It defaults to .downpoll-state.json inside DEST_DIR.
+	StateFile string `split_words:"true"`
+	// POLL_STATE_FILE is the path to the JSON file that keeps track of the
+	// newest posts seen, so that restarts resume where the last poll stopped.
+	// It defaults to .downpoll-poll.json inside DEST_DIR.
+	PollStateFile string `split_words:"true"`
+	// INFO_FORMAT is the format of the info file written for each post. It is
+	// either "text" or "json".
+	InfoFormat string `default:"text" split_words:"true"`
+	// OVERWRITE makes every file be downloaded again even if it already
+	// exists, which repairs truncated files.
+	Overwrite bool `default:"false"`
+	// INDEX_PREFIX prefixes downloaded files with their position in the post,
+	// such as "001_", so that they sort in order.
+	IndexPrefix bool `default:"false" split_words:"true"`
+	// EMBED_METADATA writes the post URL, title, creator and date into
+	// downloaded JPEG images as XMP metadata.
+	EmbedMetadata bool `default:"false" split_words:"true"`
+	// VERIFY_SIZE makes existing files be compared against the remote size
+	// and downloaded again if they are truncated.
+	VerifySize bool `default:"false" split_words:"true"`
+	// MAX_BYTES is the maximum number of bytes to download during each poll,
+	// across all of its pages. 0 means unlimited.
+	MaxBytes int64 `default:"0" split_words:"true"`
+	// PRESERVE_TIMESTAMPS sets the modification time of downloaded files to
+	// their original upload time, so that archives sort by date.
+	PreserveTimestamps bool `default:"false" split_words:"true"`
+	// MAX_PARALLEL_PER_CREATOR is the maximum parallel downloads of a single
+	// creator. 0 means no limit besides MAX_PARALLEL.
+	MaxParallelPerCreator int `default:"0" split_words:"true"`
+	// BUFFER_SIZE is the size in bytes of the buffer that each download is
+	// streamed through. 0 uses the library default.
+	BufferSize int `default:"0" split_words:"true"`
+	// REPORT_DIR is the directory to write a JSON report of every archived
+	// page into, listing the outcome of each file. Reports are not written if
+	// it is empty.
+	ReportDir string `split_words:"true"`
+	// DIAGNOSE prints the connectivity and session diagnostics on startup.
+	Diagnose bool `default:"false"`
 }
 
 func init() {
@@ -46,44 +85,119 @@ func init() {
 }
 
 func main() {
-	var cfg = Config{
-		MaxParallel: runtime.GOMAXPROCS(-1),
-	}
+	var cfg Config
 
 	if err := envconfig.Process("fanbox", &cfg); err != nil {
 		log.Fatalln("erroneous env var:", err)
 	}
 
-	session := fanbox.New(cfg.SessionID)
-	session.Retries = cfg.MaxRetries
+	app, err := newApp(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if cfg.Diagnose {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		d, err := app.session.Diagnose(ctx)
+		cancel()
 
-	app := &app{
-		Config:  cfg,
-		session: session,
-		sema:    semaphore.NewWeighted(int64(cfg.MaxRetries)),
+		if err != nil {
+			log.Println("failed to diagnose:", err)
+		} else {
+			log.Print("Diagnostics:\n", d)
+		}
 	}
 
-	if err := app.poll(true); err != nil {
+	if err := fanbox.CleanTempFiles(cfg.DestDir, time.Hour); err != nil {
+		log.Println("failed to clean up tmp files:", err)
+	}
+
+	app.session.StartKeepalive(context.Background(), cfg.PollFrequency, func(err error) {
+		log.Println("session has expired, update SESSION_ID:", err)
+	})
+
+	// Only fetch everything if we have never polled before.
+	if err := app.poll(context.Background(), app.pollState.LastPoll.IsZero()); err != nil {
 		log.Fatalln("failed to run the initial poll:", err)
 	}
 
 	for range time.Tick(cfg.PollFrequency) {
-		if err := app.poll(false); err != nil {
+		// Bound each periodic poll so that a stalled download doesn't block
+		// the next one.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.PollFrequency)
+
+		if err := app.poll(ctx, false); err != nil {
 			log.Println("failed to periodically poll:", err)
 		}
+
+		cancel()
 	}
 }
 
 type app struct {
 	Config
-	session *fanbox.Session
-	sema    *semaphore.Weighted
+	session   *fanbox.Session
+	archiver  *fanbox.Archiver
+	pollState *fanbox.PollState
 }
 
-func (c *app) poll(fetchAll bool) (err error) {
+// newApp creates the session, archiver and state files described by cfg.
+func newApp(cfg Config) (*app, error) {
+	session := fanbox.New(cfg.SessionID)
+	session.Retries = cfg.MaxRetries
+
+	if cfg.StateFile == "" {
+		cfg.StateFile = filepath.Join(cfg.DestDir, ".downpoll-state.json")
+	}
+
+	state, err := fanbox.OpenFileState(cfg.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	if cfg.PollStateFile == "" {
+		cfg.PollStateFile = filepath.Join(cfg.DestDir, ".downpoll-poll.json")
+	}
+
+	var pollState fanbox.PollState
+	if err := pollState.Load(cfg.PollStateFile); err != nil {
+		return nil, fmt.Errorf("failed to load poll state: %w", err)
+	}
+
+	opts := fanbox.DefaultArchiveOptions()
+	opts.MaxParallel = cfg.MaxParallel
+	opts.AllowFileExts = cfg.AllowFileExts
+	opts.AllowAnimations = cfg.AllowAnimations
+	opts.InfoFormat = fanbox.InfoFormat(cfg.InfoFormat)
+	opts.Dedup = cfg.Dedup
+	opts.Overwrite = cfg.Overwrite
+	opts.IndexPrefix = cfg.IndexPrefix
+	opts.EmbedMetadata = cfg.EmbedMetadata
+	opts.VerifySize = cfg.VerifySize
+	opts.MaxBytes = cfg.MaxBytes
+	opts.PreserveTimestamps = cfg.PreserveTimestamps
+	opts.BufferSize = cfg.BufferSize
+	opts.MaxParallelPerCreator = cfg.MaxParallelPerCreator
+	opts.ReportDir = cfg.ReportDir
+
+	archiver := fanbox.NewArchiver(session, cfg.DestDir, opts)
+	archiver.State = state
+
+	return &app{
+		Config:    cfg,
+		session:   session,
+		archiver:  archiver,
+		pollState: &pollState,
+	}, nil
+}
+
+func (c *app) poll(ctx context.Context, fetchAll bool) (err error) {
 	var lastPage *fanbox.Page
 	var page = 0
 
+	// MAX_BYTES applies to the whole poll.
+	c.archiver.ResetBudget()
+
 PageLoop:
 	for page < c.MaxPageBehind {
 		log.Printf("Scanning page %d.\n", page)
@@ -104,186 +218,80 @@ PageLoop:
 			return fmt.Errorf("failed to get supporting posts page %d: %w", page, err)
 		}
 
-		lastFetched, err := c.downloadPage(lastPage)
-		if err != nil {
-			return fmt.Errorf("failed to download page %d: %w", page, err)
-		}
-
-		if !fetchAll && lastFetched {
-			break PageLoop
+		for _, warning := range lastPage.Warnings {
+			log.Println("warning:", warning)
 		}
 
-		log.Printf("Page %d has last item unfetched or is initial fetch; continuing.", page)
-		page++
-	}
-
-	log.Printf("Finished fetching up until page %d.", page)
-
-	return nil
-}
-
-func (c *app) downloadPage(page *fanbox.Page) (lastFetched bool, err error) {
-	for _, item := range page.Body.Items {
-		var urls []string
-		var text string
-
-		switch body := item.Body.(type) {
-		case *fanbox.ImageBody:
-			urls = make([]string, len(body.Images))
-			text = body.Text
-
-			for i, image := range body.Images {
-				urls[i] = image.OriginalURL
-			}
-
-		case *fanbox.FileBody:
-			urls = make([]string, 0, len(body.Files))
-			text = body.Text
-
-			for _, file := range body.Files {
-				if c.AllowFileExts.Include(file.Extension) {
-					urls = append(urls, file.URL)
-				}
-			}
-
-		case *fanbox.ArticleBody:
-			urls = make([]string, 0, len(body.Blocks))
-			bld := strings.Builder{}
-
-			for _, block := range body.Blocks {
-				switch block.Type {
-				case "image":
-					urls = append(urls, fanbox.PostImageURL(item.ID, block.ImageID))
-					fmt.Fprintf(&bld, "<image id=\"%s\" />\n\n", block.ImageID)
-				case "p":
-					fmt.Fprintf(&bld, "%s\n\n", block.Text)
-				}
-			}
-
-			text = bld.String()
-
-		default:
-			continue
+		result, err := c.archiver.ArchivePageContext(ctx, lastPage)
+		if err != nil && !errors.Is(err, fanbox.ErrBudgetExceeded) {
+			return fmt.Errorf("failed to download page %d: %w", page, err)
 		}
 
-		if len(urls) == 0 {
-			continue
+		for _, url := range result.FailedURLs {
+			log.Println("failed to download after retrying:", url)
 		}
 
-		dir := filepath.Join(
-			c.DestDir,
-			sanitizePath(item.CreatorID),
-			fmt.Sprintf(
-				"%s: %s",
-				time.Time(item.PublishedDateTime).Format("2006-01-02"),
-				sanitizePath(item.Title),
-			),
-		)
-
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			return false, errors.Wrap(err, "failed to mkdir -p for item")
+		if err != nil {
+			// The rest of the page was never looked at, so none of it is
+			// recorded as seen; the next poll picks it up again.
+			log.Printf("Stopping at page %d: %v.", page, err)
+			break PageLoop
 		}
 
-		var fetchedItems int
-
-		for _, url := range urls {
-			oURL := url
-			name := filepath.Base(oURL)
-
-			// Check if we already have the image.
-			_, err := os.Stat(filepath.Join(dir, name))
-			if err == nil {
-				fetchedItems++
-				continue
+		allSeen := true
+		for _, item := range lastPage.Body.Items {
+			if !c.pollState.Seen(item) {
+				allSeen = false
+				break
 			}
-
-			// Acquire a semaphore outside instead so we don't overwhelm the
-			// Pixiv server too much.
-			c.sema.Acquire(context.Background(), 1)
-
-			go func() {
-				defer c.sema.Release(1)
-
-				r, err := c.session.Download(oURL)
-				if err != nil {
-					log.Println("failed to download image:", err)
-					return
-				}
-				defer r.Close()
-
-				if err := downloadFile(dir, name, r); err != nil {
-					log.Println("failed to write image file:", err)
-				}
-			}()
 		}
 
-		text = fmt.Sprintf("%s\n\n%s", item.URL(), text)
+		c.pollState.Update(completeItems(lastPage.Body.Items, result.IncompletePostIDs))
 
-		if err := writeText(dir, "info", text); err != nil {
-			log.Println("failed to write info file:", err)
+		if !fetchAll && (result.LastFetched || allSeen) {
+			break PageLoop
 		}
 
-		// set on each loop, use last iteration
-		lastFetched = fetchedItems == len(urls)
+		log.Printf("Page %d has last item unfetched or is initial fetch; continuing.", page)
+		page++
 	}
 
-	return
-}
-
-func downloadFile(dir, file string, r io.Reader) error {
-	dst := filepath.Join(dir, file)
-	tmp := filepath.Join(dir, tmpFilename())
-
-	return writeTmp(dst, tmp, r)
-}
-
-func writeText(dir, file, text string) error {
-	dst := filepath.Join(dir, file)
-	tmp := filepath.Join(dir, tmpFilename())
+	log.Printf("Finished fetching up until page %d.", page)
 
-	_, err := os.Stat(filepath.Join(dir, file))
-	if err == nil {
-		return nil
+	c.pollState.LastPoll = time.Now()
+	if err := c.pollState.Save(c.PollStateFile); err != nil {
+		log.Println("failed to save poll state:", err)
 	}
 
-	return writeTmp(dst, tmp, strings.NewReader(text))
+	return nil
 }
 
-func writeTmp(dst, tmp string, r io.Reader) error {
-	f, err := os.Create(tmp)
-	if err != nil {
-		return errors.Wrap(err, "failed to create tmp image file")
+// completeItems returns the items whose creators have no incomplete posts
+// among items. Recording a newer post of such a creator as seen would make the
+// incomplete one count as seen too, so it would never be retried.
+func completeItems(items []fanbox.Item, incompleteIDs []string) []fanbox.Item {
+	if len(incompleteIDs) == 0 {
+		return items
 	}
 
-	_, err = io.Copy(f, r)
-	if err != nil {
-		f.Close()
-		os.Remove(tmp)
-		return errors.Wrap(err, "failed to download image to tmp file")
+	incomplete := make(map[string]bool, len(incompleteIDs))
+	for _, id := range incompleteIDs {
+		incomplete[id] = true
 	}
 
-	f.Close()
-
-	if err := os.Rename(tmp, dst); err != nil {
-		return errors.Wrap(err, "failed to restore image tmp to dst")
+	skipCreators := make(map[string]bool)
+	for _, item := range items {
+		if incomplete[item.ID] {
+			skipCreators[item.CreatorID] = true
+		}
 	}
 
-	return nil
-}
-
-func tmpFilename() string {
-	buf := make([]byte, 12)
-	binary.LittleEndian.PutUint64(buf[0:], uint64(time.Now().UnixNano()))
-	binary.LittleEndian.PutUint32(buf[8:], rand.Uint32())
-
-	return ".tmp." + base64.RawURLEncoding.EncodeToString(buf)
-}
-
-var sanitizer = strings.NewReplacer(
-	"/", " ∕ ",
-	"\x00", "",
-)
+	complete := make([]fanbox.Item, 0, len(items))
+	for _, item := range items {
+		if !skipCreators[item.CreatorID] {
+			complete = append(complete, item)
+		}
+	}
 
-func sanitizePath(part string) string {
-	return sanitizer.Replace(part)
+	return complete
 }
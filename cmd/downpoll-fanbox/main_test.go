@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/go-fanbox/fanbox"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const testImageURL = "https://downloads.fanbox.cc/images/post/1/abc.png"
+
+const testPage = `{
+	"body": {
+		"items": [{
+			"id": "1",
+			"title": "Post",
+			"type": "image",
+			"creatorId": "creator",
+			"publishedDatetime": "2021-01-02T03:04:05+09:00",
+			"updatedDatetime": "2021-01-02T03:04:05+09:00",
+			"user": {"userId": "2", "name": "Creator"},
+			"body": {
+				"text": "",
+				"images": [{"id": "abc", "extension": "png", "originalUrl": "` + testImageURL + `"}]
+			}
+		}],
+		"nextUrl": null
+	}
+}`
+
+// testThreeImagesPage is a page with a single post of three images.
+const testThreeImagesPage = `{
+	"body": {
+		"items": [{
+			"id": "1",
+			"title": "Post",
+			"type": "image",
+			"creatorId": "creator",
+			"publishedDatetime": "2021-01-02T03:04:05+09:00",
+			"updatedDatetime": "2021-01-02T03:04:05+09:00",
+			"user": {"userId": "2", "name": "Creator"},
+			"body": {
+				"text": "",
+				"images": [
+					{"id": "a", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/1/a.png"},
+					{"id": "b", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/1/b.png"},
+					{"id": "c", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/1/c.png"}
+				]
+			}
+		}],
+		"nextUrl": null
+	}
+}`
+
+// fanboxTransport serves the given page of supporting posts, and "image" for
+// every image.
+type fanboxTransport struct {
+	page string
+}
+
+func (t fanboxTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body string
+
+	switch {
+	case r.URL.Host == "api.fanbox.cc" && r.URL.Path == "/post.listSupporting":
+		body = t.page
+	case r.URL.Host == "downloads.fanbox.cc":
+		body = "image"
+	default:
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			Request:    r,
+		}, nil
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
+
+func TestPollDefaultConfig(t *testing.T) {
+	os.Setenv("FANBOX_SESSION_ID", "session")
+	defer os.Unsetenv("FANBOX_SESSION_ID")
+
+	var cfg Config
+	if err := envconfig.Process("fanbox", &cfg); err != nil {
+		t.Fatal("failed to process default config:", err)
+	}
+
+	cfg.DestDir = t.TempDir()
+
+	app, err := newApp(cfg)
+	if err != nil {
+		t.Fatal("failed to create app:", err)
+	}
+	app.session.Client.Transport = fanboxTransport{testPage}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- app.poll(ctx, true) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("failed to poll:", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("poll did not make progress")
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(cfg.DestDir, "creator", "*", "abc.png"))
+	if len(matches) != 1 {
+		t.Fatalf("expected the image to be downloaded, got %q", matches)
+	}
+
+	b, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal("failed to read image:", err)
+	}
+
+	if string(b) != "image" {
+		t.Errorf("image = %q, expected %q", b, "image")
+	}
+
+	// The post is marked as downloaded in the background once its files are
+	// written, so wait for it before the temporary directory is removed.
+	for deadline := time.Now().Add(5 * time.Second); !app.archiver.State.Has("1"); {
+		if time.Now().After(deadline) {
+			t.Fatal("post was not marked as downloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if app.pollState.LastPoll.IsZero() {
+		t.Error("poll state was not updated")
+	}
+}
+
+func TestPollBudgetExceeded(t *testing.T) {
+	os.Setenv("FANBOX_SESSION_ID", "session")
+	defer os.Unsetenv("FANBOX_SESSION_ID")
+
+	var cfg Config
+	if err := envconfig.Process("fanbox", &cfg); err != nil {
+		t.Fatal("failed to process default config:", err)
+	}
+
+	cfg.DestDir = t.TempDir()
+	// With one download at a time, the budget is checked for the third image
+	// only after the first one has finished, so it is never downloaded.
+	cfg.MaxBytes = 1
+	cfg.MaxParallel = 1
+
+	app, err := newApp(cfg)
+	if err != nil {
+		t.Fatal("failed to create app:", err)
+	}
+	app.session.Client.Transport = fanboxTransport{testThreeImagesPage}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := app.poll(ctx, true); err != nil {
+		t.Fatal("poll failed after exceeding the budget:", err)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(cfg.DestDir, "creator", "*", "c.png"))
+	if len(matches) != 0 {
+		t.Errorf("expected the image over budget to be skipped, got %q", matches)
+	}
+
+	var saved fanbox.PollState
+	if err := saved.Load(app.PollStateFile); err != nil {
+		t.Fatal("failed to load poll state:", err)
+	}
+
+	if saved.LastPoll.IsZero() {
+		t.Error("poll state was not saved")
+	}
+
+	if app.archiver.State.Has("1") {
+		t.Error("post over budget was marked as downloaded")
+	}
+
+	// The next poll has a new budget, so it finishes the post.
+	if err := app.poll(ctx, false); err != nil {
+		t.Fatal("failed to poll again:", err)
+	}
+
+	matches, _ = filepath.Glob(filepath.Join(cfg.DestDir, "creator", "*", "c.png"))
+	if len(matches) != 1 {
+		t.Errorf("expected the next poll to download the skipped image, got %q", matches)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); !app.archiver.State.Has("1"); {
+		if time.Now().After(deadline) {
+			t.Fatal("post was not marked as downloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,32 @@
+package fanbox
+
+import "strings"
+
+// No animation-specific payload, such as the frame list and zip of Pixiv's
+// ugoira, has been observed from the Fanbox API, so none is modeled and frame
+// archives cannot be told apart from other zips. The helpers below only
+// classify regular attachments by their extension: GIFs appear as images in
+// ImageBody or ArticleBody.ImageMap, and videos appear as files in FileBody or
+// ArticleBody.FileMap. Zips can still be downloaded using AllowFileExts.
+
+// animationExts are the extensions of files that hold videos or animated
+// images.
+var animationExts = map[string]bool{
+	"gif":  true,
+	"apng": true,
+	"mp4":  true,
+	"webm": true,
+	"mov":  true,
+}
+
+// IsAnimated returns true if the image is a GIF, which is the only image format
+// that the API is known to return animated images in.
+func (i Image) IsAnimated() bool {
+	return strings.EqualFold(i.Extension, "gif")
+}
+
+// IsAnimation returns true if the file's extension is that of a video or an
+// animated image.
+func (f File) IsAnimation() bool {
+	return animationExts[strings.ToLower(f.Extension)]
+}
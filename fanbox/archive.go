@@ -0,0 +1,1045 @@
+package fanbox
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/semaphore"
+)
+
+// InfoFormat is the format of the info file that the Archiver writes.
+type InfoFormat string
+
+const (
+	// InfoFormatText writes Item.InfoText into a file named "info".
+	InfoFormatText InfoFormat = "text"
+	// InfoFormatJSON writes Item.InfoJSON into a file named "info.json".
+	InfoFormatJSON InfoFormat = "json"
+)
+
+// ArchiveOptions are the options of an Archiver that control how posts are
+// downloaded.
+type ArchiveOptions struct {
+	// MaxParallel is the maximum number of files downloaded at once. It
+	// defaults to the number of threads if not positive.
+	MaxParallel int `json:"maxParallel"`
+	// AllowFileExts is the list of allowed file extensions without the
+	// trailing dot for all files. This does not include images.
+	AllowFileExts []string `json:"allowFileExts"`
+	// AllowAnimations also allows files that are videos or animated images
+	// by their extension, regardless of AllowFileExts. See File.IsAnimation.
+	AllowAnimations bool `json:"allowAnimations"`
+	// InfoFormat is the format of the info file written for each post.
+	InfoFormat InfoFormat `json:"infoFormat"`
+	// Dedup skips files that were already downloaded as part of another post
+	// using an in-memory SeenStore, unless Archiver.Seen is set.
+	Dedup bool `json:"dedup"`
+	// Overwrite makes the Archiver download all files again even if they
+	// already exist or the post is marked as downloaded. Files are still
+	// replaced atomically.
+	Overwrite bool `json:"overwrite"`
+	// IndexPrefix prefixes downloaded files with their zero-padded position
+	// in the post, such as "001_", so that they sort in the post's order.
+	IndexPrefix bool `json:"indexPrefix"`
+	// EmbedMetadata writes the post's URL, title, creator and date into
+	// downloaded JPEG images as XMP metadata. This modifies the files' bytes.
+	EmbedMetadata bool `json:"embedMetadata"`
+	// VerifySize makes the Archiver compare the size of existing local files
+	// against the remote size and download them again if they differ. It only
+	// applies to LocalStorage, and not to images that EmbedMetadata modifies.
+	VerifySize bool `json:"verifySize"`
+	// MaxBytes is the maximum number of bytes that the Archiver downloads
+	// across all archiving calls until ResetBudget is called, which lets the
+	// caller cap a run of several calls. Once it is reached, no new downloads
+	// are started and ErrBudgetExceeded is returned, but in-flight downloads
+	// are allowed to finish. 0 means unlimited.
+	MaxBytes int64 `json:"maxBytes"`
+	// PreserveTimestamps sets the modification time of downloaded files to
+	// the Last-Modified time of the response, or the post's PublishedDateTime
+	// if there is none. It only applies to LocalStorage.
+	PreserveTimestamps bool `json:"preserveTimestamps"`
+	// MaxParallelPerCreator, if positive, is the maximum number of files of
+	// a single creator downloaded at once, in addition to MaxParallel. This
+	// keeps a creator with a lot of files from taking every download slot.
+	MaxParallelPerCreator int `json:"maxParallelPerCreator"`
+	// BufferSize is the size in bytes of the buffer that each download is
+	// streamed to storage through. Files are never held in memory whole, so
+	// downloads use about MaxParallel * BufferSize bytes of buffers. It
+	// defaults to DefaultBufferSize if not positive.
+	BufferSize int `json:"bufferSize"`
+	// ReportDir, if not empty, is the directory that a JSON Report is
+	// written into at the end of every call that waits for its downloads,
+	// such as ArchivePageContext. Each report is named after the time that
+	// the call started.
+	ReportDir string `json:"reportDir"`
+}
+
+// DefaultArchiveOptions returns the default archive options.
+func DefaultArchiveOptions() ArchiveOptions {
+	return ArchiveOptions{
+		MaxParallel:   runtime.GOMAXPROCS(-1),
+		AllowFileExts: []string{"gif", "mp4"},
+		InfoFormat:    InfoFormatText,
+	}
+}
+
+// Archiver downloads the images and files of posts into a directory tree laid
+// out as Dir/creator/date: title/.
+type Archiver struct {
+	downloaded int64 // atomic, first for alignment
+	budgetUsed int64 // atomic, reset by ResetBudget
+
+	ArchiveOptions
+	Session *Session
+	// Dir is the directory to download into.
+	Dir string
+	// Seen, if not nil, is used to skip files that were already downloaded as
+	// part of another post.
+	Seen SeenStore
+	// State, if not nil, is used to skip posts that were already fully
+	// downloaded.
+	State State
+	// Storage is where files are written into. It defaults to LocalStorage.
+	Storage Storage
+	// Have, if not nil, decides whether a file is already downloaded. It
+	// defaults to LocalAlreadyHaver for LocalStorage, and to Storage.Exists
+	// otherwise.
+	Have AlreadyHaver
+
+	sema *semaphore.Weighted
+
+	creatorMu    sync.Mutex
+	creatorSemas map[string]*semaphore.Weighted
+}
+
+// NewArchiver creates a new Archiver that downloads into dir with the given
+// options.
+func NewArchiver(s *Session, dir string, opts ArchiveOptions) *Archiver {
+	if opts.MaxParallel < 1 {
+		opts.MaxParallel = runtime.GOMAXPROCS(-1)
+	}
+
+	a := &Archiver{
+		ArchiveOptions: opts,
+		Session:        s,
+		Dir:            dir,
+		Storage:        LocalStorage{},
+		sema:           semaphore.NewWeighted(int64(opts.MaxParallel)),
+	}
+
+	if opts.Dedup {
+		a.Seen = &MemorySeenStore{}
+	}
+
+	return a
+}
+
+// ArchiveResult is the result of archiving posts.
+type ArchiveResult struct {
+	// LastFetched is true if the last item with anything to download was
+	// already fully downloaded.
+	LastFetched bool `json:"lastFetched"`
+	// Downloaded is the number of files that were downloaded.
+	Downloaded int `json:"downloaded"`
+	// Failed is the number of files that failed to download, including ones
+	// that were canceled midway. Calls that wait for their downloads retry
+	// the failed files once at the end, so it only counts persistent
+	// failures for them.
+	Failed int `json:"failed"`
+	// Skipped is the number of files whose download was never started because
+	// the context expired.
+	Skipped int `json:"skipped"`
+	// Bytes is the number of bytes downloaded.
+	Bytes int64 `json:"bytes"`
+	// FailedURLs are the URLs of the files that still failed to download
+	// after being retried at the end of the run.
+	FailedURLs []string `json:"failedUrls"`
+	// IncompletePostIDs are the IDs of the posts with files that failed to
+	// download or were skipped, sorted. It is only filled by calls that wait
+	// for their downloads.
+	IncompletePostIDs []string `json:"incompletePostIds"`
+}
+
+// DownloadStatus is the outcome of downloading a file.
+type DownloadStatus string
+
+const (
+	// DownloadDownloaded means that the file was downloaded.
+	DownloadDownloaded DownloadStatus = "downloaded"
+	// DownloadExisted means that the file was already downloaded, possibly as
+	// part of another post.
+	DownloadExisted DownloadStatus = "existed"
+	// DownloadFailed means that the download of the file failed.
+	DownloadFailed DownloadStatus = "failed"
+	// DownloadSkipped means that the download of the file was never started,
+	// such as because the context expired or the budget was exceeded.
+	DownloadSkipped DownloadStatus = "skipped"
+)
+
+// DownloadResult is the outcome of downloading a file of a post.
+type DownloadResult struct {
+	// Index is the position of the file in the post.
+	Index  int
+	URL    string
+	Path   string
+	Status DownloadStatus
+	// Err is the error that made the download fail or be skipped, if any.
+	Err error
+}
+
+// archiveRun tracks the downloads started during one archiving call.
+type archiveRun struct {
+	ctx    context.Context
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	result ArchiveResult
+	// ignoreState makes posts marked as downloaded in State be checked for
+	// missing files anyway.
+	ignoreState bool
+	// names maps each directory to the file names claimed in it during this
+	// run and the URLs that claimed them.
+	names map[string]map[string]string
+	// failures are the downloads that failed during this run, to be retried
+	// once at the end.
+	failures []failedDownload
+	// pending counts the files of each post that are not downloaded yet
+	// because their download failed or was skipped.
+	pending map[string]int
+	// onResult, if not nil, is called with the outcome of each file while mu
+	// is held. A file may be reported again if it is retried.
+	onResult func(item Item, result DownloadResult)
+	// summary, if not nil, records the outcome of each file for
+	// ArchiveOptions.ReportDir.
+	summary *Report
+}
+
+type failedDownload struct {
+	item  Item
+	index int
+	dir   string
+	name  string
+	url   string
+}
+
+// report reports the outcome of a file to onResult.
+func (r *archiveRun) report(item Item, result DownloadResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reportLocked(item, result)
+}
+
+func (r *archiveRun) reportLocked(item Item, result DownloadResult) {
+	if r.summary != nil {
+		r.summary.record(item, result)
+	}
+	if r.onResult != nil {
+		r.onResult(item, result)
+	}
+}
+
+// fail records that the download of the given file failed. retry is false if
+// the download was never started and should not be retried.
+func (r *archiveRun) fail(f failedDownload, retry bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := DownloadResult{
+		Index:  f.index,
+		URL:    f.url,
+		Path:   filepath.Join(f.dir, f.name),
+		Status: DownloadSkipped,
+		Err:    err,
+	}
+	if retry {
+		result.Status = DownloadFailed
+	}
+	r.reportLocked(f.item, result)
+
+	if r.pending == nil {
+		r.pending = make(map[string]int)
+	}
+	r.pending[f.item.ID]++
+
+	if retry {
+		r.result.Failed++
+		r.failures = append(r.failures, f)
+	} else {
+		r.result.Skipped++
+	}
+}
+
+func (r *archiveRun) add(f func(result *ArchiveResult)) {
+	r.mu.Lock()
+	f(&r.result)
+	r.mu.Unlock()
+}
+
+// claimName claims the file name for the given URL inside dir. If another URL
+// has already claimed the name during this run, then a suffix is appended, so
+// "name.ext" becomes "name (1).ext". ok is false if the same URL has already
+// claimed a name in dir.
+func (r *archiveRun) claimName(dir, name, url string) (claimed string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names == nil {
+		r.names = make(map[string]map[string]string)
+	}
+
+	names, exists := r.names[dir]
+	if !exists {
+		names = make(map[string]string)
+		r.names[dir] = names
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	claimed = name
+	for i := 1; ; i++ {
+		owner, taken := names[claimed]
+		if !taken {
+			break
+		}
+		if owner == url {
+			return claimed, false
+		}
+		claimed = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+
+	names[claimed] = url
+	return claimed, true
+}
+
+// ArchivePage downloads all items in the page. Downloads happen in the
+// background. lastFetched is true if the last item with anything to download
+// was already fully downloaded.
+func (a *Archiver) ArchivePage(page *Page) (lastFetched bool, err error) {
+	run := &archiveRun{ctx: context.Background()}
+
+	if err := a.archivePage(run, page); err != nil {
+		return false, err
+	}
+
+	return run.result.LastFetched, nil
+}
+
+// ArchivePageContext downloads all items in the page and waits for all
+// downloads to finish. Once ctx expires, the in-flight downloads are canceled
+// and no more are started; the partial result is then returned along with
+// ctx's error.
+func (a *Archiver) ArchivePageContext(ctx context.Context, page *Page) (*ArchiveResult, error) {
+	run := &archiveRun{ctx: ctx}
+	a.startReport(run)
+
+	err := a.archivePage(run, page)
+	run.wg.Wait()
+	a.retryFailed(run)
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	a.finishReport(run, err)
+
+	return &run.result, err
+}
+
+func (a *Archiver) archivePage(run *archiveRun, page *Page) error {
+	for _, item := range page.Body.Items {
+		urls := a.itemURLs(item)
+		if len(urls) == 0 {
+			continue
+		}
+
+		fetched, err := a.archiveItem(run, item, urls)
+		if err != nil {
+			return err
+		}
+
+		// set on each loop, use last iteration
+		run.result.LastFetched = fetched
+	}
+
+	return nil
+}
+
+// acquire acquires a download slot for a file of the given creator, waiting
+// for the creator's own slot first if MaxParallelPerCreator is set. The
+// returned function releases the slot.
+func (a *Archiver) acquire(ctx context.Context, creatorID string) (release func(), err error) {
+	var creatorSema *semaphore.Weighted
+
+	if a.MaxParallelPerCreator > 0 {
+		a.creatorMu.Lock()
+		creatorSema = a.creatorSemas[creatorID]
+		if creatorSema == nil {
+			if a.creatorSemas == nil {
+				a.creatorSemas = make(map[string]*semaphore.Weighted)
+			}
+			creatorSema = semaphore.NewWeighted(int64(a.MaxParallelPerCreator))
+			a.creatorSemas[creatorID] = creatorSema
+		}
+		a.creatorMu.Unlock()
+
+		if err := creatorSema.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.sema.Acquire(ctx, 1); err != nil {
+		if creatorSema != nil {
+			creatorSema.Release(1)
+		}
+		return nil, err
+	}
+
+	return func() {
+		a.sema.Release(1)
+		if creatorSema != nil {
+			creatorSema.Release(1)
+		}
+	}, nil
+}
+
+// retryFailed retries the downloads that failed during the run once, after all
+// other downloads have finished. Posts whose files are then all downloaded are
+// marked in State. The files that still fail are listed in FailedURLs, and
+// their posts in IncompletePostIDs.
+func (a *Archiver) retryFailed(run *archiveRun) {
+	run.mu.Lock()
+	failures := run.failures
+	run.failures = nil
+	run.mu.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, f := range failures {
+		f := f
+
+		release, err := a.acquire(run.ctx, f.item.CreatorID)
+		if err != nil {
+			run.add(func(r *ArchiveResult) { r.FailedURLs = append(r.FailedURLs, f.url) })
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer release()
+
+			path, err := a.download(run, f.item, f.dir, f.name, f.url)
+			if err != nil {
+				log.Println("retry failed:", err)
+				run.add(func(r *ArchiveResult) { r.FailedURLs = append(r.FailedURLs, f.url) })
+				run.report(f.item, DownloadResult{
+					Index:  f.index,
+					URL:    f.url,
+					Path:   filepath.Join(f.dir, f.name),
+					Status: DownloadFailed,
+					Err:    err,
+				})
+				return
+			}
+
+			if a.Seen != nil {
+				a.Seen.MarkSeen(DedupKey(f.url))
+			}
+
+			run.mu.Lock()
+			run.result.Failed--
+			run.result.Downloaded++
+			run.reportLocked(f.item, DownloadResult{
+				Index:  f.index,
+				URL:    f.url,
+				Path:   path,
+				Status: DownloadDownloaded,
+			})
+			run.pending[f.item.ID]--
+			done := run.pending[f.item.ID] == 0
+			run.mu.Unlock()
+
+			if done && a.State != nil {
+				if err := a.State.Mark(f.item.ID); err != nil {
+					log.Println("failed to mark post as downloaded:", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	for id, n := range run.pending {
+		if n > 0 {
+			run.result.IncompletePostIDs = append(run.result.IncompletePostIDs, id)
+		}
+	}
+	sort.Strings(run.result.IncompletePostIDs)
+}
+
+// ArchiveItem downloads the images and files of the given item into its own
+// directory. Downloads happen in the background. fetched is true if there was
+// nothing left to download.
+func (a *Archiver) ArchiveItem(item Item) (fetched bool, err error) {
+	urls := a.itemURLs(item)
+	if len(urls) == 0 {
+		return true, nil
+	}
+
+	return a.archiveItem(&archiveRun{ctx: context.Background()}, item, urls)
+}
+
+// ArchiveItemResults downloads the images and files of the given item at once
+// and waits for them to finish. Failed downloads are retried once at the end.
+// The outcome of every file is returned in the post's order, regardless of
+// the order that the downloads finish in.
+func (a *Archiver) ArchiveItemResults(ctx context.Context, item Item) ([]DownloadResult, error) {
+	urls := a.itemURLs(item)
+	dir := a.ItemDir(item)
+
+	status := DownloadSkipped
+	if !a.Overwrite && a.State != nil && a.State.Has(item.ID) {
+		status = DownloadExisted
+	}
+
+	names := &archiveRun{}
+	results := make([]DownloadResult, len(urls))
+
+	for i, url := range urls {
+		name, _ := names.claimName(dir, a.fileName(i, url), url)
+		results[i] = DownloadResult{
+			Index:  i,
+			URL:    url,
+			Path:   filepath.Join(dir, name),
+			Status: status,
+		}
+	}
+
+	if len(urls) == 0 || status == DownloadExisted {
+		return results, nil
+	}
+
+	run := &archiveRun{
+		ctx: ctx,
+		onResult: func(_ Item, result DownloadResult) {
+			results[result.Index] = result
+		},
+	}
+	a.startReport(run)
+
+	_, err := a.archiveItem(run, item, urls)
+	run.wg.Wait()
+	a.retryFailed(run)
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	a.finishReport(run, err)
+
+	if err != nil {
+		for i, result := range results {
+			if result.Status == DownloadSkipped && result.Err == nil {
+				results[i].Err = err
+			}
+		}
+	}
+
+	return results, err
+}
+
+// ArchiveMissing downloads the images and files of the given item that are
+// not on disk yet, even if the post is marked as downloaded in State. This
+// picks up files that were added to the post after it was archived. It waits
+// for all downloads to finish.
+func (a *Archiver) ArchiveMissing(ctx context.Context, item Item) (*ArchiveResult, error) {
+	run := &archiveRun{ctx: ctx, ignoreState: true}
+
+	urls := a.itemURLs(item)
+	if len(urls) == 0 {
+		return &run.result, nil
+	}
+
+	a.startReport(run)
+
+	_, err := a.archiveItem(run, item, urls)
+	run.wg.Wait()
+	a.retryFailed(run)
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	a.finishReport(run, err)
+
+	return &run.result, err
+}
+
+// ItemDir returns the directory that the given item is downloaded into.
+func (a *Archiver) ItemDir(item Item) string {
+	return filepath.Join(a.Dir, filepath.FromSlash(itemPath(item)))
+}
+
+// itemPath returns the slash-separated relative path of the item's directory.
+func itemPath(item Item) string {
+	return path.Join(
+		sanitizePath(item.CreatorID),
+		fmt.Sprintf(
+			"%s: %s",
+			time.Time(item.PublishedDateTime).Format("2006-01-02"),
+			sanitizePath(item.Title),
+		),
+	)
+}
+
+func (a *Archiver) allowFileExt(ext string) bool {
+	for _, allowed := range a.AllowFileExts {
+		if allowed == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// itemURLs returns the URLs to download of the item.
+func (a *Archiver) itemURLs(item Item) []string {
+	return itemURLs(item, func(file File) bool {
+		return a.allowFileExt(file.Extension) || (a.AllowAnimations && file.IsAnimation())
+	})
+}
+
+// itemURLs returns the URLs of the images and files in the item. Only files
+// for which allowFile returns true are included.
+func itemURLs(item Item, allowFile func(File) bool) (urls []string) {
+	switch body := item.Body.(type) {
+	case *ImageBody:
+		urls = make([]string, len(body.Images))
+		for i, image := range body.Images {
+			urls[i] = image.OriginalURL
+		}
+
+	case *FileBody:
+		urls = make([]string, 0, len(body.Files))
+		for _, file := range body.Files {
+			if allowFile(file) {
+				urls = append(urls, file.URL)
+			}
+		}
+
+	case *ArticleBody:
+		for _, resource := range body.Resources() {
+			switch resource.Type {
+			case ResourceImage:
+				urls = append(urls, PostImageURL(item.ID, resource.Image.ID))
+			case ResourceFile:
+				if resource.File.URL != "" && allowFile(*resource.File) {
+					urls = append(urls, resource.File.URL)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// fileName returns the name of the file at the given URL and index within its
+// post, before collisions are resolved.
+func (a *Archiver) fileName(i int, url string) string {
+	return fileName(i, url, a.IndexPrefix)
+}
+
+func fileName(i int, url string, indexPrefix bool) string {
+	name := urlFileName(url)
+	if indexPrefix {
+		name = fmt.Sprintf("%03d_%s", i+1, name)
+	}
+	return name
+}
+
+func (a *Archiver) archiveItem(run *archiveRun, item Item, urls []string) (bool, error) {
+	if run.summary != nil {
+		run.mu.Lock()
+		run.summary.item(item)
+		run.mu.Unlock()
+	}
+
+	if !a.Overwrite && !run.ignoreState && a.State != nil && a.State.Has(item.ID) {
+		return true, nil
+	}
+
+	dir := a.ItemDir(item)
+	sizes := itemFileSizes(item)
+
+	var fetchedItems int
+	var budgetErr error
+	var failed bool
+	var failedMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, url := range urls {
+		oURL := url
+
+		name, ok := run.claimName(dir, a.fileName(i, oURL), oURL)
+		existed := DownloadResult{
+			Index:  i,
+			URL:    oURL,
+			Path:   filepath.Join(dir, name),
+			Status: DownloadExisted,
+		}
+
+		if !ok {
+			// The same file is listed twice in the post.
+			run.report(item, existed)
+			fetchedItems++
+			continue
+		}
+
+		key := DedupKey(oURL)
+
+		if !a.Overwrite {
+			// Check if we already have the image.
+			size, ok := sizes[oURL]
+			if !ok {
+				size = -1
+			}
+
+			if a.haveFile(filepath.Join(dir, name), oURL, size) {
+				run.report(item, existed)
+				fetchedItems++
+				continue
+			}
+
+			// Check if we've already downloaded the same file for another
+			// post.
+			if a.Seen != nil && a.Seen.Seen(key) {
+				run.report(item, existed)
+				fetchedItems++
+				continue
+			}
+		}
+
+		if a.budgetExceeded() {
+			budgetErr = ErrBudgetExceeded
+			break
+		}
+
+		failure := failedDownload{item, i, dir, name, oURL}
+
+		skip := func(err error) {
+			run.fail(failure, false, err)
+
+			failedMu.Lock()
+			failed = true
+			failedMu.Unlock()
+		}
+
+		// Acquire a semaphore outside instead so we don't overwhelm the Pixiv
+		// server too much. With a per-creator limit, the download waits for
+		// its creator's slot in the background instead, so that the other
+		// creators' files can take the free slots meanwhile.
+		var release func()
+		if a.MaxParallelPerCreator <= 0 {
+			r, err := a.acquire(run.ctx, item.CreatorID)
+			if err != nil {
+				skip(err)
+				continue
+			}
+			release = r
+		}
+
+		wg.Add(1)
+		run.wg.Add(1)
+
+		go func() {
+			defer run.wg.Done()
+			defer wg.Done()
+
+			if release == nil {
+				r, err := a.acquire(run.ctx, item.CreatorID)
+				if err != nil {
+					skip(err)
+					return
+				}
+				release = r
+			}
+			defer release()
+
+			path, err := a.download(run, item, dir, name, oURL)
+			if err != nil {
+				log.Println(err)
+				run.fail(failure, true, err)
+
+				failedMu.Lock()
+				failed = true
+				failedMu.Unlock()
+				return
+			}
+
+			run.add(func(r *ArchiveResult) { r.Downloaded++ })
+			run.report(item, DownloadResult{
+				Index:  failure.index,
+				URL:    oURL,
+				Path:   path,
+				Status: DownloadDownloaded,
+			})
+
+			if a.Seen != nil {
+				a.Seen.MarkSeen(key)
+			}
+		}()
+	}
+
+	if err := a.writeInfo(dir, item); err != nil {
+		log.Println("failed to write info file:", err)
+	}
+
+	if budgetErr != nil {
+		return false, budgetErr
+	}
+
+	if a.State != nil {
+		go func() {
+			wg.Wait()
+
+			if failed {
+				return
+			}
+
+			if err := a.State.Mark(item.ID); err != nil {
+				log.Println("failed to mark post as downloaded:", err)
+			}
+		}()
+	}
+
+	return fetchedItems == len(urls), nil
+}
+
+// DownloadedBytes returns the number of bytes downloaded by the Archiver so
+// far.
+func (a *Archiver) DownloadedBytes() int64 {
+	return atomic.LoadInt64(&a.downloaded)
+}
+
+// ResetBudget resets the bytes counted towards MaxBytes, such as at the start
+// of a run. DownloadedBytes is not reset.
+func (a *Archiver) ResetBudget() {
+	atomic.StoreInt64(&a.budgetUsed, 0)
+}
+
+func (a *Archiver) budgetExceeded() bool {
+	return a.MaxBytes > 0 && atomic.LoadInt64(&a.budgetUsed) >= a.MaxBytes
+}
+
+type countingReader struct {
+	r   io.Reader
+	add func(n int)
+}
+
+func (r countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.add(n)
+	}
+	return n, err
+}
+
+// haveFile returns true if the file at path does not need to be downloaded
+// from url again. expectedSize is -1 if unknown.
+func (a *Archiver) haveFile(path, url string, expectedSize int64) bool {
+	_, local := a.storage().(LocalStorage)
+
+	// Files with embedded metadata are larger than the remote file, so their
+	// size cannot be compared.
+	embedded := a.embedsMetadata(path)
+	if local && !embedded && filepath.Ext(path) == "" {
+		if sniffed, ok := findLocalFile(path); ok {
+			embedded = a.embedsMetadata(sniffed)
+		}
+	}
+	if embedded {
+		expectedSize = -1
+	}
+
+	haver := a.Have
+	if haver == nil {
+		if !local {
+			return a.storage().Exists(path)
+		}
+
+		local := LocalAlreadyHaver{}
+		if a.VerifySize && !embedded {
+			local.Session = a.Session
+		}
+		haver = local
+	}
+
+	complete, err := haver.AlreadyHave(path, url, expectedSize)
+	if err != nil {
+		log.Println("failed to verify file:", err)
+		// Assume that the file is complete if it exists, since the request may
+		// fail again anyway.
+		if _, local := a.storage().(LocalStorage); local {
+			_, ok := findLocalFile(path)
+			return ok
+		}
+		return a.storage().Exists(path)
+	}
+
+	return complete
+}
+
+// embedsMetadata returns true if XMP metadata is embedded into the file with
+// the given name when it is downloaded.
+func (a *Archiver) embedsMetadata(name string) bool {
+	if !a.EmbedMetadata {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *Archiver) storage() Storage {
+	if a.Storage == nil {
+		return LocalStorage{}
+	}
+	return a.Storage
+}
+
+func (a *Archiver) writeInfo(dir string, item Item) error {
+	name := "info"
+	text := ""
+
+	switch a.InfoFormat {
+	case InfoFormatJSON:
+		b, err := item.InfoJSON()
+		if err != nil {
+			return errors.Wrap(err, "failed to encode info")
+		}
+		name = "info.json"
+		text = string(b)
+	default:
+		text = item.InfoText()
+	}
+
+	path := filepath.Join(dir, name)
+	if a.storage().Exists(path) {
+		return nil
+	}
+
+	return writeFile(a.storage(), path, strings.NewReader(text), a.BufferSize)
+}
+
+func (a *Archiver) download(run *archiveRun, item Item, dir, name, url string) (string, error) {
+	// Extensionless downloads are named after their content type.
+	r, name, err := a.Session.downloadNamed(run.ctx, url, name)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download image")
+	}
+	defer r.Close()
+
+	var src io.Reader = countingReader{r, func(n int) {
+		atomic.AddInt64(&a.downloaded, int64(n))
+		atomic.AddInt64(&a.budgetUsed, int64(n))
+		run.add(func(r *ArchiveResult) { r.Bytes += int64(n) })
+	}}
+
+	if a.embedsMetadata(name) {
+		embedded, err := EmbedXMP(src, ItemXMPMetadata(item))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to embed metadata")
+		}
+		src = embedded
+	}
+
+	dst := filepath.Join(dir, name)
+
+	if err := writeFile(a.storage(), dst, src, a.BufferSize); err != nil {
+		return "", errors.Wrap(err, "failed to write image file")
+	}
+
+	if _, local := a.storage().(LocalStorage); local && a.PreserveTimestamps {
+		mtime := time.Time(item.PublishedDateTime)
+		if t, err := http.ParseTime(responseHeader(r).Get("Last-Modified")); err == nil {
+			mtime = t
+		}
+
+		if err := os.Chtimes(dst, mtime, mtime); err != nil {
+			return "", errors.Wrap(err, "failed to set file times")
+		}
+	}
+
+	return dst, nil
+}
+
+func tmpFilename() string {
+	buf := make([]byte, 12)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(time.Now().UnixNano()))
+	binary.LittleEndian.PutUint32(buf[8:], rand.Uint32())
+
+	return ".tmp." + base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// CleanTempFiles removes the temporary files left behind in dir and its
+// subdirectories by interrupted downloads. Only files last modified more than
+// olderThan ago are removed, so that downloads still in progress are kept.
+func CleanTempFiles(dir string, olderThan time.Duration) error {
+	deadline := time.Now().Add(-olderThan)
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() || !strings.HasPrefix(info.Name(), ".tmp.") {
+			return nil
+		}
+
+		if info.ModTime().After(deadline) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return errors.Wrap(err, "failed to remove tmp file")
+		}
+
+		return nil
+	})
+}
+
+var sanitizer = strings.NewReplacer(
+	"/", " ∕ ",
+	"\x00", "",
+)
+
+func sanitizePath(part string) string {
+	return sanitizer.Replace(part)
+}
@@ -0,0 +1,48 @@
+package fanbox
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time for the delays of a SessionClient, which are the
+// retry delay, HostIntervals, RateLimitThreshold and WithDownloadRateLimit.
+// It can be replaced to simulate time in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep blocks for the given duration or until ctx is done, whichever
+	// comes first.
+	Sleep(ctx context.Context, d time.Duration)
+}
+
+// RealClock is a Clock that uses the system time. It is the default.
+type RealClock struct{}
+
+var _ Clock = RealClock{}
+
+// Now implements Clock.
+func (RealClock) Now() time.Time { return time.Now() }
+
+// Sleep implements Clock.
+func (RealClock) Sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// clock returns the client's Clock, which defaults to RealClock.
+func (sc *SessionClient) clock() Clock {
+	if sc.Clock != nil {
+		return sc.Clock
+	}
+	return RealClock{}
+}
@@ -0,0 +1,113 @@
+package fanbox
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CommentPage is a page of comments.
+type CommentPage struct {
+	Body CommentPageBody `json:"body"`
+}
+
+type CommentPageBody struct {
+	Items   []Comment `json:"items"`
+	NextURL string    `json:"nextUrl"`
+}
+
+type Comment struct {
+	ID              string   `json:"id"`
+	ParentCommentID string   `json:"parentCommentId"`
+	RootCommentID   string   `json:"rootCommentId"`
+	Body            string   `json:"body"`
+	CreatedDateTime DateTime `json:"createdDatetime"`
+	LikeCount       int      `json:"likeCount"`
+	IsLiked         bool     `json:"isLiked"`
+	IsOwn           bool     `json:"isOwn"`
+	User            User     `json:"user"`
+	// Replies contains the replies that are returned inline with the comment.
+	// It may not contain all of them; use CommentReplies to fetch the rest.
+	Replies []Comment `json:"replies"`
+}
+
+// PostComments returns the first limit top-level comments of the given post.
+// The returned page's NextURL can be used with CommentsFromURL for
+// continuation.
+func (s *Session) PostComments(postID string, limit int) (*CommentPage, error) {
+	limit, err := clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{
+		"postId": {postID},
+		"limit":  {strconv.Itoa(limit)},
+	}
+
+	return s.CommentsFromURL(APIEndpoint("/post.listComments", v))
+}
+
+// CommentsFromURL returns the page of comments at the given URL.
+func (s *Session) CommentsFromURL(url string) (*CommentPage, error) {
+	if err := checkHost(url); err != nil {
+		return nil, err
+	}
+
+	var page *CommentPage
+	return page, s.Get(url, &page)
+}
+
+// CommentReplies returns all replies of the given comment. Replies are not
+// paginated: the endpoint returns every reply at once, so this is the way to
+// get the replies that were left out of Comment.Replies.
+func (s *Session) CommentReplies(commentID string) ([]Comment, error) {
+	v := url.Values{
+		"commentId": {commentID},
+	}
+
+	var resp struct {
+		Body []Comment `json:"body"`
+	}
+
+	if err := s.Get(APIEndpoint("/post.getCommentReplies", v), &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// AddComment posts a comment with the given body on the given post. If
+// parentCommentID is not empty, then the comment is posted as a reply to that
+// comment; otherwise, it is a top-level comment.
+func (s *Session) AddComment(postID, body, parentCommentID string) (*Comment, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, errors.New("comment body is empty")
+	}
+
+	var resp struct {
+		Body *Comment `json:"body"`
+	}
+
+	// Posting a comment twice duplicates it, so it is not retried.
+	err := s.postJSONOnce(APIEndpoint("/post.addComment", nil), map[string]string{
+		"postId":          postID,
+		"body":            body,
+		"parentCommentId": parentCommentID,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// LikeComment likes the comment with the given ID. Only transient failures are
+// retried. An *AuthError is returned if the session is rejected.
+func (s *Session) LikeComment(commentID string) error {
+	return s.postJSON(APIEndpoint("/post.likeComment", nil), map[string]string{
+		"commentId": commentID,
+	}, nil)
+}
@@ -0,0 +1,266 @@
+package fanbox
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// Creator is a Fanbox creator.
+type Creator struct {
+	User            User     `json:"user"`
+	CreatorID       string   `json:"creatorId"`
+	Description     string   `json:"description"`
+	HasAdultContent bool     `json:"hasAdultContent"`
+	CoverImageURL   string   `json:"coverImageUrl"`
+	ProfileLinks    []string `json:"profileLinks"`
+	IsFollowed      bool     `json:"isFollowed"`
+	IsSupported     bool     `json:"isSupported"`
+	IsStopped       bool     `json:"isStopped"`
+	Category        string   `json:"category"`
+	// FollowerCount, SupporterCount and PostCount are only returned by
+	// creator.get, so they are 0 in other responses.
+	FollowerCount  int `json:"followerCount"`
+	SupporterCount int `json:"supporterCount"`
+	PostCount      int `json:"postCount"`
+}
+
+// Creator returns the creator with the given creator ID, including their
+// follower, supporter and post counts.
+func (s *Session) Creator(creatorID string) (*Creator, error) {
+	v := url.Values{
+		"creatorId": {creatorID},
+	}
+
+	var resp struct {
+		Body *Creator `json:"body"`
+	}
+
+	if err := s.Get(APIEndpoint("/creator.get", v), &resp); err != nil {
+		return nil, asAuthError(err)
+	}
+
+	if resp.Body == nil {
+		return nil, errors.New("creator not found")
+	}
+
+	return resp.Body, nil
+}
+
+// RecommendedCreators returns the creators that Fanbox recommends to the user.
+// An empty slice is returned if there are none. An *AuthError is returned if
+// the session is rejected.
+func (s *Session) RecommendedCreators() ([]Creator, error) {
+	var resp struct {
+		Body []Creator `json:"body"`
+	}
+
+	if err := s.Get(APIEndpoint("/creator.listRecommended", nil), &resp); err != nil {
+		return nil, asAuthError(err)
+	}
+
+	if resp.Body == nil {
+		return []Creator{}, nil
+	}
+
+	return resp.Body, nil
+}
+
+// CreatorPosts returns the first limit posts of the given creator, newest
+// first.
+func (s *Session) CreatorPosts(creatorID string, limit int) (*Page, error) {
+	limit, err := clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{
+		"creatorId": {creatorID},
+		"limit":     {strconv.Itoa(limit)},
+	}
+
+	return s.PostsFromURL(APIEndpoint("/post.listCreator", v))
+}
+
+// CreatorPostsUntil returns the posts of the given creator, newest first, up
+// until the post with the ID stopAtID, which is not included. All posts are
+// returned if stopAtID is never encountered.
+func (s *Session) CreatorPostsUntil(creatorID, stopAtID string) ([]Item, error) {
+	page, err := s.CreatorPosts(creatorID, MaxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+
+	for {
+		for _, item := range page.Body.Items {
+			if item.ID == stopAtID {
+				return items, nil
+			}
+			items = append(items, item)
+		}
+
+		if page.Body.NextURL == "" {
+			return items, nil
+		}
+
+		page, err = s.PostsFromURL(page.Body.NextURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CreatorPageURLs returns the URLs of every page of the given creator's posts,
+// which lets the pages be fetched without following NextURL.
+func (s *Session) CreatorPageURLs(creatorID string) ([]string, error) {
+	v := url.Values{
+		"creatorId": {creatorID},
+	}
+
+	var resp struct {
+		Body []string `json:"body"`
+	}
+
+	if err := s.Get(APIEndpoint("/post.paginateCreator", v), &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// AllCreatorPosts returns all posts of the given creator, newest first. If
+// the page URLs can be listed with CreatorPageURLs, then up to maxParallel
+// pages are fetched at once; otherwise, the pages are fetched one after
+// another by following NextURL.
+func (s *Session) AllCreatorPosts(ctx context.Context, creatorID string, maxParallel int) ([]Item, error) {
+	urls, err := s.CreatorPageURLs(creatorID)
+	if err != nil || len(urls) == 0 {
+		return s.CreatorPostsUntil(creatorID, "")
+	}
+
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	pages := make([]*Page, len(urls))
+	sema := semaphore.NewWeighted(int64(maxParallel))
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, pageURL := range urls {
+		i, pageURL := i, pageURL
+
+		if err := sema.Acquire(gctx, 1); err != nil {
+			break
+		}
+
+		g.Go(func() error {
+			defer sema.Release(1)
+
+			page, err := s.PostsFromURL(pageURL)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get page %d", i)
+			}
+
+			pages[i] = page
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for _, page := range pages {
+		items = append(items, page.Body.Items...)
+	}
+
+	return items, nil
+}
+
+// MonthBucket is a month in which a creator published posts. Months are in
+// the time zone of the posts' PublishedDateTime, which is Japan time.
+type MonthBucket struct {
+	Year  int
+	Month time.Month
+	// Count is the number of posts published during the month.
+	Count int
+}
+
+// CreatorPostMonths returns the months in which the given creator published
+// posts, newest first. Fanbox has no endpoint for this, so all of the
+// creator's posts are listed and counted.
+func (s *Session) CreatorPostMonths(creatorID string) ([]MonthBucket, error) {
+	items, err := s.CreatorPostsUntil(creatorID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var months []MonthBucket
+
+	for _, item := range items {
+		t := time.Time(item.PublishedDateTime)
+
+		if n := len(months); n > 0 && months[n-1].Year == t.Year() && months[n-1].Month == t.Month() {
+			months[n-1].Count++
+			continue
+		}
+
+		months = append(months, MonthBucket{
+			Year:  t.Year(),
+			Month: t.Month(),
+			Count: 1,
+		})
+	}
+
+	return months, nil
+}
+
+// CreatorMonthPosts returns the posts of the given creator that were published
+// during the given month, newest first. Pages are fetched until a post older
+// than the month is found.
+func (s *Session) CreatorMonthPosts(creatorID string, year int, month time.Month) ([]Item, error) {
+	page, err := s.CreatorPosts(creatorID, MaxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	target := year*12 + int(month)
+	var items []Item
+
+	for {
+		for _, item := range page.Body.Items {
+			t := time.Time(item.PublishedDateTime)
+
+			switch current := t.Year()*12 + int(t.Month()); {
+			case current > target:
+				continue
+			case current < target:
+				return items, nil
+			}
+
+			items = append(items, item)
+		}
+
+		if page.Body.NextURL == "" {
+			return items, nil
+		}
+
+		page, err = s.PostsFromURL(page.Body.NextURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
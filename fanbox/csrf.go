@@ -0,0 +1,63 @@
+package fanbox
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// csrfCache caches the CSRF token of a session.
+type csrfCache struct {
+	mu    sync.Mutex
+	token string
+}
+
+// csrfToken returns the CSRF token required by write endpoints. The token is
+// fetched once and cached until invalidateCSRFToken is called.
+func (s *Session) csrfToken() (string, error) {
+	if s.csrf == nil {
+		return s.fetchCSRFToken()
+	}
+
+	s.csrf.mu.Lock()
+	defer s.csrf.mu.Unlock()
+
+	if s.csrf.token != "" {
+		return s.csrf.token, nil
+	}
+
+	token, err := s.fetchCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.csrf.token = token
+	return token, nil
+}
+
+// invalidateCSRFToken clears the cached CSRF token, so that the next call to
+// csrfToken fetches it again.
+func (s *Session) invalidateCSRFToken() {
+	if s.csrf == nil {
+		return
+	}
+
+	s.csrf.mu.Lock()
+	s.csrf.token = ""
+	s.csrf.mu.Unlock()
+}
+
+// fetchCSRFToken fetches the CSRF token. It is found in the metadata embedded
+// into the HTML page of the website.
+func (s *Session) fetchCSRFToken() (string, error) {
+	metadata, err := s.fetchMetadata()
+	if err != nil {
+		return "", err
+	}
+
+	if metadata.CSRFToken == "" {
+		return "", errors.New("no CSRF token found in page")
+	}
+
+	return metadata.CSRFToken, nil
+}
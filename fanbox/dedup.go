@@ -0,0 +1,60 @@
+package fanbox
+
+import (
+	"net/url"
+	"path"
+	"sync"
+)
+
+// SeenStore is a set of files that have already been downloaded. Downloaders
+// consult it to avoid fetching identical files that are reused across posts.
+// Implementations may be backed by a file or a database; they must be safe to
+// use concurrently.
+type SeenStore interface {
+	// Seen returns true if the given key has been marked.
+	Seen(key string) bool
+	// MarkSeen marks the given key as downloaded.
+	MarkSeen(key string)
+}
+
+// DedupKey returns the key used to identify a file in a SeenStore. Fanbox
+// names uploaded files by their hash, so the last path element of the URL is
+// the same across posts that reuse the same file.
+func DedupKey(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL
+	}
+
+	return path.Base(u.Path)
+}
+
+// MemorySeenStore is a SeenStore that lives in memory. The zero value is ready
+// to be used.
+type MemorySeenStore struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+var _ SeenStore = (*MemorySeenStore)(nil)
+
+// Seen implements SeenStore.
+func (s *MemorySeenStore) Seen(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.seen[key]
+	return ok
+}
+
+// MarkSeen implements SeenStore.
+func (s *MemorySeenStore) MarkSeen(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen == nil {
+		s.seen = make(map[string]struct{})
+	}
+
+	s.seen[key] = struct{}{}
+}
@@ -0,0 +1,135 @@
+package fanbox
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Diagnostics is the result of Session.Diagnose. Each failed check has its
+// error set, and the checks that depend on it are left empty.
+type Diagnostics struct {
+	// Host is the API host that was checked.
+	Host string
+	// Addrs are the addresses that Host resolved to.
+	Addrs   []string
+	DNSErr  error
+	Latency time.Duration
+	// TLSVersion is the negotiated TLS version, such as "TLS 1.3".
+	TLSVersion string
+	// StatusCode is the status code of a bare request to the API.
+	StatusCode int
+	ConnectErr error
+	// Cloudflare is true if the response came from Cloudflare, and Challenged
+	// is true if Cloudflare answered with a challenge page instead of the API.
+	Cloudflare bool
+	Challenged bool
+	// ClockSkew is the local time minus the server's Date header. It is 0 if
+	// the server did not send a date.
+	ClockSkew time.Duration
+	// User is the user that the session is logged in as, or nil if it is not.
+	User    *User
+	AuthErr error
+}
+
+// OK returns true if every check passed.
+func (d *Diagnostics) OK() bool {
+	return d.DNSErr == nil && d.ConnectErr == nil && !d.Challenged && d.AuthErr == nil
+}
+
+// String formats the diagnostics as human-readable lines.
+func (d *Diagnostics) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Host: %s\n", d.Host)
+	if d.DNSErr != nil {
+		fmt.Fprintf(&b, "DNS: %v\n", d.DNSErr)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "DNS: %s\n", strings.Join(d.Addrs, ", "))
+
+	if d.ConnectErr != nil {
+		fmt.Fprintf(&b, "Connection: %v\n", d.ConnectErr)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Connection: %s, status %d, %v\n", d.TLSVersion, d.StatusCode, d.Latency)
+	fmt.Fprintf(&b, "Cloudflare: %t, challenged: %t\n", d.Cloudflare, d.Challenged)
+	fmt.Fprintf(&b, "Clock skew: %v\n", d.ClockSkew)
+
+	if d.AuthErr != nil {
+		fmt.Fprintf(&b, "Session: %v\n", d.AuthErr)
+	} else {
+		fmt.Fprintf(&b, "Session: logged in as %s (%s)\n", d.User.Name, d.User.UserID)
+	}
+
+	return b.String()
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// Diagnose checks whether the API is reachable and the session is accepted,
+// which helps telling network, Cloudflare and authentication problems apart.
+// The checks are not retried. An error is only returned if ctx is done.
+func (s *Session) Diagnose(ctx context.Context) (*Diagnostics, error) {
+	u, err := url.Parse(APIURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse API URL")
+	}
+
+	d := &Diagnostics{Host: u.Hostname()}
+
+	d.Addrs, d.DNSErr = net.DefaultResolver.LookupHost(ctx, d.Host)
+	if d.DNSErr != nil {
+		return d, ctx.Err()
+	}
+
+	request, err := s.newRequest(ctx, "GET", APIURL+"/", nil, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	r, err := s.Do(request)
+	if err != nil {
+		d.ConnectErr = err
+		return d, ctx.Err()
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(r.Body, 64*1024))
+	r.Body.Close()
+
+	d.Latency = time.Since(start)
+	d.StatusCode = r.StatusCode
+
+	if r.TLS != nil {
+		d.TLSVersion = tlsVersions[r.TLS.Version]
+	}
+
+	d.Cloudflare = r.Header.Get("CF-Ray") != "" ||
+		strings.EqualFold(r.Header.Get("Server"), "cloudflare")
+	d.Challenged = isCloudflareChallenge(r.StatusCode, r.Header, body)
+
+	if date, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+		// The Date header only has a precision of a second, so measure from
+		// the middle of the request.
+		d.ClockSkew = start.Add(d.Latency / 2).Sub(date).Truncate(time.Second)
+	}
+
+	d.User, d.AuthErr = s.Me()
+	return d, ctx.Err()
+}
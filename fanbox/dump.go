@@ -0,0 +1,32 @@
+package fanbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DumpFilename returns the name of the file that the JSON response of the
+// given URL is dumped into.
+func DumpFilename(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+func dumpResponse(dir, url string, b []byte) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed to mkdir -p dump dir")
+	}
+
+	dst := filepath.Join(dir, DumpFilename(url))
+
+	if err := ioutil.WriteFile(dst, b, 0644); err != nil {
+		return errors.Wrap(err, "failed to write response dump")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package fanbox
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBudgetExceeded is returned by the Archiver once it has downloaded
+// ArchiveOptions.MaxBytes bytes since its budget was last reset.
+var ErrBudgetExceeded = errors.New("download byte budget exceeded")
+
+// ErrCloudflareChallenge is returned when Cloudflare answers with a challenge
+// page instead of the response. It is not retried, since the challenge must be
+// solved in a browser and the cf_clearance cookie updated.
+var ErrCloudflareChallenge = errors.New("blocked by a Cloudflare challenge")
+
+// cloudflareMarkers are strings found in the Cloudflare challenge pages.
+var cloudflareMarkers = [][]byte{
+	[]byte("cf-chl-"),
+	[]byte("cf_chl_opt"),
+	[]byte("challenge-platform"),
+	[]byte("<title>Just a moment...</title>"),
+}
+
+// isCloudflareChallenge returns true if the response with the given status,
+// header and body is a Cloudflare challenge page.
+func isCloudflareChallenge(status int, header http.Header, body []byte) bool {
+	if status != http.StatusForbidden && status != http.StatusServiceUnavailable {
+		return false
+	}
+
+	if header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+
+	for _, marker := range cloudflareMarkers {
+		if bytes.Contains(body, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatusError is returned when the server responds with a non-2xx status
+// code.
+type StatusError struct {
+	StatusCode int
+	Body       []byte // may be empty
+}
+
+func (err *StatusError) Error() string {
+	if len(err.Body) == 0 {
+		return fmt.Sprintf("unexpected status code %d", err.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code %d, body %s", err.StatusCode, err.Body)
+}
+
+// isStatus returns true if err is a StatusError with the given status code.
+func isStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+// AuthError is returned by write operations when the server rejects the
+// session, such as when the session has expired or the CSRF token is invalid.
+// It lets callers distinguish authentication failures from network errors.
+type AuthError struct {
+	Err *StatusError
+}
+
+func (err *AuthError) Error() string {
+	return "not authorized: " + err.Err.Error()
+}
+
+func (err *AuthError) Unwrap() error {
+	return err.Err
+}
+
+// asAuthError wraps err into an AuthError if it is a 401 or 403 StatusError.
+func asAuthError(err error) error {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	}
+
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{statusErr}
+	default:
+		return err
+	}
+}
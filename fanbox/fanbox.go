@@ -2,10 +2,14 @@ package fanbox
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/url"
+	"path"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
@@ -13,11 +17,97 @@ import (
 
 type Page struct {
 	Body PageBody `json:"body"`
+	// Warnings contains the non-fatal issues found while decoding the items
+	// of the page.
+	Warnings []Warning `json:"-"`
+}
+
+func (p *Page) UnmarshalJSON(b []byte) error {
+	type rawPage Page
+
+	if err := json.Unmarshal(b, (*rawPage)(p)); err != nil {
+		return err
+	}
+
+	p.Warnings = nil
+	for _, item := range p.Body.Items {
+		if item.warning != nil {
+			p.Warnings = append(p.Warnings, *item.warning)
+		}
+	}
+
+	return nil
+}
+
+// Warning is a non-fatal issue found while decoding an item, such as an
+// unknown item type. The item is still kept, but its body may be nil.
+type Warning struct {
+	PostID      string
+	Description string
+}
+
+// Error implements error.
+func (w Warning) Error() string {
+	return fmt.Sprintf("post %s: %s", w.PostID, w.Description)
 }
 
 type PageBody struct {
 	Items   []Item `json:"items"`
-	NextURL string `json:"nextUrl"`
+	NextURL string `json:"nextUrl"` // empty if last page
+}
+
+func (pb *PageBody) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Items   []Item          `json:"items"`
+		NextURL json.RawMessage `json:"nextUrl"`
+		Next    json.RawMessage `json:"next"`
+	}
+
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	next := raw.NextURL
+	if len(next) == 0 {
+		next = raw.Next
+	}
+
+	nextURL, err := decodeNextURL(next)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal next URL")
+	}
+
+	pb.Items = raw.Items
+	pb.NextURL = nextURL
+	return nil
+}
+
+// decodeNextURL decodes the next URL of a page, which may be absent, null, a
+// string, or an object containing the URL.
+func decodeNextURL(b json.RawMessage) (string, error) {
+	b = bytes.TrimSpace(b)
+
+	switch {
+	case len(b) == 0, bytes.Equal(b, []byte("null")):
+		return "", nil
+	case b[0] == '"':
+		var s string
+		return s, json.Unmarshal(b, &s)
+	case b[0] == '{':
+		var obj struct {
+			URL     string `json:"url"`
+			NextURL string `json:"nextUrl"`
+		}
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return "", err
+		}
+		if obj.URL != "" {
+			return obj.URL, nil
+		}
+		return obj.NextURL, nil
+	default:
+		return "", fmt.Errorf("unexpected next URL %s", b)
+	}
 }
 
 type DateTime time.Time
@@ -50,6 +140,133 @@ type ItemBase struct {
 	CreatorID         string   `json:"creatorId"`
 	HasAdultContent   bool     `json:"hasAdultContent"`
 	Status            string   `json:"status"`
+	Tags              []string `json:"tags"`
+	// TagInfo contains the full tags, including their counts if the API
+	// returns tags as objects. It has the same order as Tags.
+	TagInfo []Tag `json:"-"`
+	// IsRestricted is true if the body of the post is not accessible to the
+	// user. RestrictedFor is the reason or access level that it is restricted
+	// for, such as "plan", if the API returns it.
+	IsRestricted  bool   `json:"isRestricted"`
+	RestrictedFor string `json:"restrictedFor,omitempty"`
+	// Currency is the ISO 4217 currency code of FeeRequired. It is empty if
+	// the API does not return it, in which case the fee is in JPY.
+	Currency string `json:"currency,omitempty"`
+}
+
+// UnmarshalJSON unmarshals the item base. CoverImageURL is filled from either
+// the flat coverImageUrl field or the nested cover object.
+func (ib *ItemBase) UnmarshalJSON(b []byte) error {
+	type rawItemBase ItemBase
+
+	var v struct {
+		rawItemBase
+		// Cover is the nested shape of the cover image that some posts use
+		// instead of coverImageUrl.
+		Cover *struct {
+			Type string `json:"type"` // "cover_image"
+			URL  string `json:"url"`
+		} `json:"cover"`
+		// Tags shadows ItemBase.Tags, since tags may be either strings or
+		// objects.
+		Tags json.RawMessage `json:"tags"`
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*ib = ItemBase(v.rawItemBase)
+
+	tags, err := decodeTags(v.Tags)
+	if err != nil {
+		return errors.Wrap(err, "failed to unmarshal tags")
+	}
+
+	// Keep an empty array empty instead of nil, so that it is encoded back
+	// as [].
+	ib.TagInfo = tags
+	ib.Tags = nil
+	if tags != nil {
+		ib.Tags = make([]string, 0, len(tags))
+	}
+	for _, tag := range tags {
+		ib.Tags = append(ib.Tags, tag.Name)
+	}
+
+	if ib.CoverImageURL == "" && v.Cover != nil {
+		ib.CoverImageURL = v.Cover.URL
+	}
+
+	return nil
+}
+
+// Tag is a tag of a post.
+type Tag struct {
+	Name string `json:"name"`
+	// Count is the number of posts with the tag, or 0 if the API does not
+	// return it.
+	Count int `json:"count,omitempty"`
+}
+
+// decodeTags decodes tags that are either an array of strings or an array of
+// objects.
+func decodeTags(b json.RawMessage) ([]Tag, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		return nil, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, len(raw))
+
+	for i, r := range raw {
+		r = bytes.TrimSpace(r)
+
+		var err error
+		if len(r) > 0 && r[0] == '"' {
+			err = json.Unmarshal(r, &tags[i].Name)
+		} else {
+			err = json.Unmarshal(r, &tags[i])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// FeeString returns the formatted required fee, such as "¥500".
+func (i ItemBase) FeeString() string {
+	return formatFee(i.FeeRequired, i.Currency)
+}
+
+// DefaultCurrency is the currency assumed when the API does not return one.
+const DefaultCurrency = "JPY"
+
+var currencySymbols = map[string]string{
+	"JPY": "¥",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
+
+func formatFee(fee int, currency string) string {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	if symbol, ok := currencySymbols[currency]; ok {
+		return fmt.Sprintf("%s%d", symbol, fee)
+	}
+
+	return fmt.Sprintf("%d %s", fee, currency)
 }
 
 // URL returns the direct URL to the post.
@@ -74,7 +291,9 @@ type ItemBody interface {
 
 type Item struct {
 	ItemBase
-	Body ItemBody `json:"body"` // ArticleBody || ImageBody
+	Body ItemBody `json:"body"` // ArticleBody || ImageBody || FileBody || LockedBody
+
+	warning *Warning
 }
 
 func (i *Item) UnmarshalJSON(b []byte) error {
@@ -82,6 +301,14 @@ func (i *Item) UnmarshalJSON(b []byte) error {
 		return errors.Wrap(err, "failed to unmarshal item base")
 	}
 
+	var rawContainer struct {
+		Body json.RawMessage `json:"body"`
+	}
+
+	if err := json.Unmarshal(b, &rawContainer); err != nil {
+		return errors.Wrap(err, "failed to unmarshal item body")
+	}
+
 	var bodyContainer struct {
 		Body ItemBody `json:"body"`
 	}
@@ -94,7 +321,22 @@ func (i *Item) UnmarshalJSON(b []byte) error {
 	case ItemTypeFile:
 		bodyContainer.Body = &FileBody{}
 	default:
-		log.Printf("Unknown item type: %q\n", i.Type) // TODO
+		i.warning = &Warning{
+			PostID:      i.ID,
+			Description: fmt.Sprintf("unknown item type %q", i.Type),
+		}
+		return nil
+	}
+
+	if len(rawContainer.Body) == 0 {
+		i.warning = &Warning{
+			PostID:      i.ID,
+			Description: "missing body",
+		}
+	}
+
+	if isEmptyBody(rawContainer.Body) {
+		i.Body = LockedBody{}
 		return nil
 	}
 
@@ -106,6 +348,61 @@ func (i *Item) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// IsLocked returns true if the item's body is not accessible, which is usually
+// because the user is not supporting the creator at the required fee.
+func (i Item) IsLocked() bool {
+	_, ok := i.Body.(LockedBody)
+	return ok
+}
+
+// ContentHash returns a stable hash over the item's title, body text and the
+// IDs of its images, files and embeds. It can be compared against a stored value to
+// detect edits, since UpdatedDateTime is not always reliable.
+func (i Item) ContentHash() string {
+	h := sha256.New()
+	write := func(s string) {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+
+	write(i.Title)
+
+	switch body := i.Body.(type) {
+	case *ImageBody:
+		write(body.Text)
+		for _, image := range body.Images {
+			write(image.ID)
+		}
+	case *FileBody:
+		write(body.Text)
+		for _, file := range body.Files {
+			write(file.ID)
+		}
+	case *ArticleBody:
+		for _, block := range body.Blocks {
+			write(block.Type)
+			write(block.Text)
+			write(block.ImageID)
+			write(block.FileID)
+			write(block.EmbedID)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isEmptyBody(b json.RawMessage) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) == 0 || bytes.Equal(b, []byte("null")) || bytes.Equal(b, []byte("{}"))
+}
+
+// LockedBody is the body of an item of a known type whose body was returned
+// null or empty by the API because it is not accessible. It distinguishes
+// access-restricted posts from genuinely empty ones.
+type LockedBody struct{}
+
+func (LockedBody) itemBody() {}
+
 type ImageBody struct {
 	Text   string  `json:"text"`
 	Images []Image `json:"images"`
@@ -113,6 +410,30 @@ type ImageBody struct {
 
 func (*ImageBody) itemBody() {}
 
+// UnmarshalJSON unmarshals the image body. If the flat images array is absent,
+// then Images is filled from the imageMap and blocks that some image posts
+// return instead, in the same order as ArticleBody.Images.
+func (ib *ImageBody) UnmarshalJSON(b []byte) error {
+	type rawImageBody ImageBody
+
+	var v struct {
+		rawImageBody
+		ArticleBody
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*ib = ImageBody(v.rawImageBody)
+
+	if len(ib.Images) == 0 && len(v.ImageMap) > 0 {
+		ib.Images = v.ArticleBody.Images()
+	}
+
+	return nil
+}
+
 type FileBody struct {
 	Files []File `json:"files"`
 	Text  string `json:"text"`
@@ -126,20 +447,102 @@ type File struct {
 	Name      string `json:"name"`
 	Size      int64  `json:"size"`
 	URL       string `json:"url"`
+	// FeeRequired is the fee required to access this file if the post has
+	// assets at different fee tiers. It is 0 if the API does not provide it,
+	// in which case the post's FeeRequired applies.
+	FeeRequired int `json:"feeRequired,omitempty"`
 }
 
+// Filename returns the name that the website gives the file when it is
+// downloaded, which is its name and extension, or its ID if it has no name.
+func (f File) Filename() string {
+	name := f.Name
+	if name == "" {
+		name = f.ID
+	}
+	if f.Extension == "" {
+		return name
+	}
+	return name + "." + f.Extension
+}
+
+// ArticleBody is the body of an article post. The API does not paginate
+// article bodies: the whole article is returned in one response, so Blocks is
+// always complete. An article that cannot be fully read has a LockedBody
+// instead, and the list endpoints return the same body as GetPost.
 type ArticleBody struct {
 	Blocks   []ArticleBodyBlock `json:"blocks"`
 	ImageMap map[string]Image   `json:"imageMap"`
-	// TODO: maybe EmbedMap and FileMap
+	FileMap  map[string]File    `json:"fileMap"`
+	EmbedMap map[string]Embed   `json:"embedMap"`
 }
 
 func (*ArticleBody) itemBody() {}
 
+// Images returns the images in the article's ImageMap in a deterministic
+// order: first in the order that the blocks reference them, then the
+// unreferenced ones sorted by ID.
+func (b *ArticleBody) Images() []Image {
+	images := make([]Image, 0, len(b.ImageMap))
+	seen := make(map[string]struct{}, len(b.ImageMap))
+
+	for _, block := range b.Blocks {
+		if block.Type != "image" {
+			continue
+		}
+
+		image, ok := b.ImageMap[block.ImageID]
+		if !ok {
+			continue
+		}
+
+		if _, dup := seen[block.ImageID]; dup {
+			continue
+		}
+
+		seen[block.ImageID] = struct{}{}
+		images = append(images, image)
+	}
+
+	rest := make([]string, 0, len(b.ImageMap)-len(images))
+	for id := range b.ImageMap {
+		if _, ok := seen[id]; !ok {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+
+	for _, id := range rest {
+		images = append(images, b.ImageMap[id])
+	}
+
+	return images
+}
+
 type ArticleBodyBlock struct {
-	Type    string `json:"type"`
-	Text    string `json:"text,omitempty"`    // Type == "p"
-	ImageID string `json:"imageId,omitempty"` // Type == "image"
+	Type    string       `json:"type"`
+	Text    string       `json:"text,omitempty"`    // Type == "p"
+	ImageID string       `json:"imageId,omitempty"` // Type == "image"
+	FileID  string       `json:"fileId,omitempty"`  // Type == "file"
+	EmbedID string       `json:"embedId,omitempty"` // Type == "embed"
+	Styles  []BlockStyle `json:"styles,omitempty"`  // Type == "p"
+	Links   []BlockLink  `json:"links,omitempty"`   // Type == "p"
+}
+
+// BlockStyle is a style applied to a range of a paragraph block's text. The
+// offset and length are in UTF-16 code units, like JavaScript strings.
+type BlockStyle struct {
+	Type   string `json:"type"` // "bold"
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// BlockLink is a hyperlink over a range of a paragraph block's text. The
+// offset and length are in UTF-16 code units, like JavaScript strings.
+type BlockLink struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url"`
 }
 
 type User struct {
@@ -155,12 +558,51 @@ type Image struct {
 	Height       int    `json:"height"`
 	OriginalURL  string `json:"originalUrl"`
 	ThumbnailURL string `json:"thumbnailUrl"`
+	// FeeRequired is the fee required to access this image. See
+	// File.FeeRequired.
+	FeeRequired int `json:"feeRequired,omitempty"`
 }
 
-// PostImageURL returns the direct link to the image in JPEG format.
+// AspectRatio returns the width divided by the height of the image. 0 is
+// returned if the height is unknown.
+func (i Image) AspectRatio() float64 {
+	if i.Height == 0 {
+		return 0
+	}
+	return float64(i.Width) / float64(i.Height)
+}
+
+// IsPortrait returns true if the image is taller than it is wide.
+func (i Image) IsPortrait() bool {
+	return i.Height > i.Width
+}
+
+// Filename returns the name that the website gives the image when it is
+// downloaded, which is its ID and extension. The extension falls back to the
+// one in OriginalURL.
+func (i Image) Filename() string {
+	if i.Extension != "" {
+		return i.ID + "." + i.Extension
+	}
+	return i.ID + path.Ext(i.OriginalURL)
+}
+
+// IsLandscape returns true if the image is wider than it is tall.
+func (i Image) IsLandscape() bool {
+	return i.Width > i.Height
+}
+
+// PostImageURL returns the direct link to the image in JPEG format, 1200
+// pixels wide.
 func PostImageURL(postID, imageID string) string {
+	return PostImageURLSize(postID, imageID, 1200)
+}
+
+// PostImageURLSize is like PostImageURL, but the image is resized to the given
+// width in pixels, such as 800 or 1600, by the CDN.
+func PostImageURLSize(postID, imageID string, width int) string {
 	return fmt.Sprintf(
-		"https://downloads.fanbox.cc/images/post/%s/w/1200/%s.jpeg",
-		postID, imageID,
+		"https://downloads.fanbox.cc/images/post/%s/w/%d/%s.jpeg",
+		url.PathEscape(postID), width, url.PathEscape(imageID),
 	)
 }
@@ -0,0 +1,281 @@
+package fanbox
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestItemBaseTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		tags    []string
+		tagInfo []Tag
+	}{
+		{
+			name:    "strings",
+			json:    `{"tags": ["a", "b"]}`,
+			tags:    []string{"a", "b"},
+			tagInfo: []Tag{{Name: "a"}, {Name: "b"}},
+		},
+		{
+			name:    "objects",
+			json:    `{"tags": [{"name": "a", "count": 3}, {"name": "b"}]}`,
+			tags:    []string{"a", "b"},
+			tagInfo: []Tag{{Name: "a", Count: 3}, {Name: "b"}},
+		},
+		{
+			name:    "null",
+			json:    `{"tags": null}`,
+			tags:    nil,
+			tagInfo: nil,
+		},
+		{
+			name:    "missing",
+			json:    `{}`,
+			tags:    nil,
+			tagInfo: nil,
+		},
+		{
+			name:    "empty",
+			json:    `{"tags": []}`,
+			tags:    []string{},
+			tagInfo: []Tag{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ib ItemBase
+			if err := json.Unmarshal([]byte(test.json), &ib); err != nil {
+				t.Fatal("failed to unmarshal:", err)
+			}
+
+			if !reflect.DeepEqual(ib.Tags, test.tags) {
+				t.Errorf("Tags = %#v, expected %#v", ib.Tags, test.tags)
+			}
+
+			if !reflect.DeepEqual(ib.TagInfo, test.tagInfo) {
+				t.Errorf("TagInfo = %#v, expected %#v", ib.TagInfo, test.tagInfo)
+			}
+		})
+	}
+}
+
+func TestItemBaseTagsEmptyInfoJSON(t *testing.T) {
+	var item Item
+	if err := json.Unmarshal([]byte(`{"id": "1", "tags": [], "body": null}`), &item); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+
+	b, err := item.InfoJSON()
+	if err != nil {
+		t.Fatal("failed to encode info:", err)
+	}
+
+	var info struct {
+		Tags json.RawMessage `json:"tags"`
+	}
+
+	if err := json.Unmarshal(b, &info); err != nil {
+		t.Fatal("failed to decode info:", err)
+	}
+
+	if string(info.Tags) != "[]" {
+		t.Errorf("tags = %s, expected []", info.Tags)
+	}
+}
+
+func TestPageBodyNextURL(t *testing.T) {
+	const next = "https://api.fanbox.cc/post.listSupporting?limit=10&maxId=1"
+
+	tests := []struct {
+		name    string
+		json    string
+		nextURL string
+		err     bool
+	}{
+		{"missing", `{"items": []}`, "", false},
+		{"null", `{"items": [], "nextUrl": null}`, "", false},
+		{"empty", `{"items": [], "nextUrl": ""}`, "", false},
+		{"present", `{"items": [], "nextUrl": "` + next + `"}`, next, false},
+		{"object url", `{"items": [], "nextUrl": {"url": "` + next + `"}}`, next, false},
+		{"object nextUrl", `{"items": [], "nextUrl": {"nextUrl": "` + next + `"}}`, next, false},
+		{"alternate key", `{"items": [], "next": "` + next + `"}`, next, false},
+		{"alternate key object", `{"items": [], "next": {"url": "` + next + `"}}`, next, false},
+		{"invalid", `{"items": [], "nextUrl": 1}`, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body PageBody
+			err := json.Unmarshal([]byte(test.json), &body)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to unmarshal:", err)
+			}
+
+			if body.NextURL != test.nextURL {
+				t.Errorf("NextURL = %q, expected %q", body.NextURL, test.nextURL)
+			}
+		})
+	}
+}
+
+func TestArticleBodyImagesOrder(t *testing.T) {
+	const article = `{
+		"blocks": [
+			{"type": "p", "text": "hello"},
+			{"type": "image", "imageId": "m"},
+			{"type": "image", "imageId": "c"},
+			{"type": "image", "imageId": "m"},
+			{"type": "image", "imageId": "missing"}
+		],
+		"imageMap": {
+			"z": {"id": "z", "extension": "png"},
+			"c": {"id": "c", "extension": "jpg"},
+			"a": {"id": "a", "extension": "png"},
+			"m": {"id": "m", "extension": "jpg"},
+			"q": {"id": "q", "extension": "gif"}
+		}
+	}`
+
+	expected := []string{"m", "c", "a", "q", "z"}
+
+	// Map iteration order is randomized, so decode a few times to make sure
+	// that the order does not depend on it.
+	for i := 0; i < 20; i++ {
+		var body ArticleBody
+		if err := json.Unmarshal([]byte(article), &body); err != nil {
+			t.Fatal("failed to unmarshal:", err)
+		}
+
+		images := body.Images()
+
+		ids := make([]string, len(images))
+		for i, image := range images {
+			ids[i] = image.ID
+		}
+
+		if !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("run %d: image IDs = %q, expected %q", i, ids, expected)
+		}
+	}
+}
+
+func TestItemBaseCoverImageURL(t *testing.T) {
+	const cover = "https://pixiv.pximg.net/c/1200x630_90_a2_g5/fanbox/public/images/post/1/cover/a.jpeg"
+
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"flat", `{"coverImageUrl": "` + cover + `"}`},
+		{"nested", `{"cover": {"type": "cover_image", "url": "` + cover + `"}}`},
+		{"both", `{"coverImageUrl": "` + cover + `", "cover": {"type": "cover_image", "url": "https://example.com/other.jpeg"}}`},
+		{"flat null", `{"coverImageUrl": null, "cover": {"type": "cover_image", "url": "` + cover + `"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ib ItemBase
+			if err := json.Unmarshal([]byte(test.json), &ib); err != nil {
+				t.Fatal("failed to unmarshal:", err)
+			}
+
+			if ib.CoverImageURL != cover {
+				t.Errorf("CoverImageURL = %q, expected %q", ib.CoverImageURL, cover)
+			}
+		})
+	}
+
+	var ib ItemBase
+	if err := json.Unmarshal([]byte(`{"cover": null}`), &ib); err != nil {
+		t.Fatal("failed to unmarshal without cover:", err)
+	}
+
+	if ib.CoverImageURL != "" {
+		t.Errorf("CoverImageURL = %q without cover, expected empty", ib.CoverImageURL)
+	}
+}
+
+func TestImageBodyImageMap(t *testing.T) {
+	const body = `{
+		"text": "hello",
+		"blocks": [
+			{"type": "image", "imageId": "b"}
+		],
+		"imageMap": {
+			"a": {"id": "a", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/1/a.png"},
+			"b": {"id": "b", "extension": "jpeg", "originalUrl": "https://downloads.fanbox.cc/images/post/1/b.jpeg"}
+		}
+	}`
+
+	var ib ImageBody
+	if err := json.Unmarshal([]byte(body), &ib); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+
+	if ib.Text != "hello" {
+		t.Errorf("Text = %q, expected %q", ib.Text, "hello")
+	}
+
+	ids := make([]string, len(ib.Images))
+	for i, image := range ib.Images {
+		ids[i] = image.ID
+	}
+
+	if expected := []string{"b", "a"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("image IDs = %q, expected %q", ids, expected)
+	}
+
+	if url := ib.Images[0].OriginalURL; url != "https://downloads.fanbox.cc/images/post/1/b.jpeg" {
+		t.Errorf("OriginalURL = %q", url)
+	}
+}
+
+func TestImageBodyImagesArray(t *testing.T) {
+	const body = `{
+		"images": [{"id": "x", "extension": "png"}],
+		"imageMap": {"a": {"id": "a", "extension": "png"}}
+	}`
+
+	var ib ImageBody
+	if err := json.Unmarshal([]byte(body), &ib); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+
+	if len(ib.Images) != 1 || ib.Images[0].ID != "x" {
+		t.Fatalf("images = %+v, expected only the images array", ib.Images)
+	}
+}
+
+func TestItemContentHashArticleBlocks(t *testing.T) {
+	articles := []string{
+		`{"type": "article", "body": {"blocks": [{"type": "file", "fileId": "a"}]}}`,
+		`{"type": "article", "body": {"blocks": [{"type": "file", "fileId": "b"}]}}`,
+		`{"type": "article", "body": {"blocks": [{"type": "embed", "embedId": "a"}]}}`,
+		`{"type": "article", "body": {"blocks": [{"type": "embed", "embedId": "b"}]}}`,
+	}
+
+	hashes := make(map[string]int, len(articles))
+
+	for i, article := range articles {
+		var item Item
+		if err := json.Unmarshal([]byte(article), &item); err != nil {
+			t.Fatal("failed to unmarshal:", err)
+		}
+
+		hash := item.ContentHash()
+		if j, ok := hashes[hash]; ok {
+			t.Errorf("articles %d and %d have the same hash", j, i)
+		}
+		hashes[hash] = i
+	}
+}
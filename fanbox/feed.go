@@ -0,0 +1,75 @@
+package fanbox
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// ItemsToRSS returns an RSS 2.0 document of the given items by the given
+// creator, using the items' URLs, titles, excerpts and publish dates.
+func ItemsToRSS(items []Item, creator User) ([]byte, error) {
+	link := OriginURL
+	if len(items) > 0 {
+		link = fmt.Sprintf("%s/@%s", OriginURL, url.PathEscape(items[0].CreatorID))
+	}
+
+	doc := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       creator.Name,
+			Link:        link,
+			Description: fmt.Sprintf("Posts by %s on Pixiv Fanbox", creator.Name),
+			Items:       make([]rssItem, len(items)),
+		},
+	}
+
+	for i, item := range items {
+		doc.Channel.Items[i] = rssItem{
+			Title:       item.Title,
+			Link:        item.URL(),
+			Description: item.Excerpt,
+			PubDate:     time.Time(item.PublishedDateTime).Format(time.RFC1123Z),
+			GUID: rssGUID{
+				Value:       item.URL(),
+				IsPermaLink: true,
+			},
+		}
+	}
+
+	b, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode RSS")
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
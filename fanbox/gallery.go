@@ -0,0 +1,168 @@
+package fanbox
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GalleryEntry is a post in a gallery along with its downloaded files.
+type GalleryEntry struct {
+	Item Item
+	// Files are the slash-separated paths to the downloaded files of the
+	// post, relative to the gallery page.
+	Files []string
+}
+
+type galleryCreator struct {
+	Name  string
+	ID    string
+	Posts []galleryPost
+}
+
+type galleryPost struct {
+	Title string
+	URL   string
+	Date  string
+	Files []galleryFile
+}
+
+type galleryFile struct {
+	Name  string
+	Link  string
+	Image bool
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Fanbox Archive</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.files { display: flex; flex-wrap: wrap; gap: 8px; }
+.files img { height: 200px; object-fit: cover; }
+</style>
+</head>
+<body>
+{{- range .}}
+<h1>{{.Name}} ({{.ID}})</h1>
+{{- range .Posts}}
+<h2>{{.Date}}: <a href="{{.URL}}">{{.Title}}</a></h2>
+<div class="files">
+{{- range .Files}}
+{{- if .Image}}
+<a href="{{.Link}}"><img src="{{.Link}}" alt="{{.Name}}" loading="lazy"></a>
+{{- else}}
+<a href="{{.Link}}">{{.Name}}</a>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+var galleryImageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// WriteGallery writes an HTML page that shows the files of the given posts,
+// grouped by creator and sorted by date with the newest post first. Images are
+// shown inline and link to themselves; other files are linked by name.
+func WriteGallery(w io.Writer, entries []GalleryEntry) error {
+	var creators []*galleryCreator
+	byID := make(map[string]*galleryCreator)
+
+	sorted := append([]GalleryEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti := time.Time(sorted[i].Item.PublishedDateTime)
+		tj := time.Time(sorted[j].Item.PublishedDateTime)
+		return ti.After(tj)
+	})
+
+	for _, entry := range sorted {
+		creator, ok := byID[entry.Item.CreatorID]
+		if !ok {
+			creator = &galleryCreator{
+				Name: entry.Item.User.Name,
+				ID:   entry.Item.CreatorID,
+			}
+			byID[entry.Item.CreatorID] = creator
+			creators = append(creators, creator)
+		}
+
+		post := galleryPost{
+			Title: entry.Item.Title,
+			URL:   entry.Item.URL(),
+			Date:  time.Time(entry.Item.PublishedDateTime).Format("2006-01-02"),
+		}
+
+		for _, file := range entry.Files {
+			post.Files = append(post.Files, galleryFile{
+				Name:  path.Base(file),
+				Link:  (&url.URL{Path: file}).String(),
+				Image: galleryImageExts[strings.ToLower(path.Ext(file))],
+			})
+		}
+
+		creator.Posts = append(creator.Posts, post)
+	}
+
+	return galleryTemplate.Execute(w, creators)
+}
+
+// WriteGallery writes an index.html gallery into Dir that shows the files of
+// the given posts that are downloaded. See the package-level WriteGallery.
+func (a *Archiver) WriteGallery(items []Item) error {
+	entries := make([]GalleryEntry, 0, len(items))
+
+	for _, item := range items {
+		run := &archiveRun{}
+		dir := a.ItemDir(item)
+		entry := GalleryEntry{Item: item}
+
+		for i, url := range a.itemURLs(item) {
+			name, ok := run.claimName(dir, a.fileName(i, url), url)
+			if !ok {
+				continue
+			}
+
+			file, ok := findLocalFile(filepath.Join(dir, name))
+			if !ok {
+				continue
+			}
+
+			rel, err := filepath.Rel(a.Dir, file)
+			if err != nil {
+				return errors.Wrap(err, "failed to get relative path")
+			}
+
+			entry.Files = append(entry.Files, filepath.ToSlash(rel))
+		}
+
+		if len(entry.Files) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGallery(&buf, entries); err != nil {
+		return errors.Wrap(err, "failed to render gallery")
+	}
+
+	return writeFile(a.storage(), filepath.Join(a.Dir, "index.html"), &buf, a.BufferSize)
+}
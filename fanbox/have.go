@@ -0,0 +1,73 @@
+package fanbox
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// AlreadyHaver decides whether a file is already downloaded, so that the
+// Archiver can skip it. It allows the check to work with storage backends
+// other than the local filesystem.
+type AlreadyHaver interface {
+	// AlreadyHave returns true if the file downloaded from url into path is
+	// complete. expectedSize is the size that the API reports for the file,
+	// or -1 if it is unknown.
+	AlreadyHave(path, url string, expectedSize int64) (bool, error)
+}
+
+// LocalAlreadyHaver is an AlreadyHaver for files on the local filesystem. A
+// file only counts as downloaded if its size matches the expected size, so
+// partial files are downloaded again. An extensionless path also matches the
+// file that was saved with the extension sniffed from its content.
+type LocalAlreadyHaver struct {
+	// Session, if not nil, is used to get the remote size of files whose
+	// expected size is unknown. Otherwise, such files count as downloaded if
+	// they exist.
+	Session *Session
+}
+
+var _ AlreadyHaver = LocalAlreadyHaver{}
+
+// AlreadyHave implements AlreadyHaver.
+func (h LocalAlreadyHaver) AlreadyHave(path, url string, expectedSize int64) (bool, error) {
+	path, ok := findLocalFile(path)
+	if !ok {
+		return false, nil
+	}
+
+	if expectedSize < 0 && h.Session != nil {
+		return h.Session.LocalFileComplete(url, path)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to stat local file")
+	}
+
+	return expectedSize < 0 || stat.Size() == expectedSize, nil
+}
+
+// itemFileSizes returns the sizes that the API reports for the files of the
+// item, keyed by URL. Images and files whose size is not reported are left
+// out.
+func itemFileSizes(item Item) map[string]int64 {
+	sizes := make(map[string]int64)
+
+	switch body := item.Body.(type) {
+	case *FileBody:
+		for _, file := range body.Files {
+			if file.Size > 0 {
+				sizes[file.URL] = file.Size
+			}
+		}
+	case *ArticleBody:
+		for _, file := range body.FileMap {
+			if file.Size > 0 {
+				sizes[file.URL] = file.Size
+			}
+		}
+	}
+
+	return sizes
+}
@@ -0,0 +1,131 @@
+package fanbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Text returns the text of the item's body. Images in articles are written as
+// <image id="..." /> placeholders.
+func (i Item) Text() string {
+	switch body := i.Body.(type) {
+	case *ImageBody:
+		return body.Text
+	case *FileBody:
+		return body.Text
+	case *ArticleBody:
+		bld := strings.Builder{}
+
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "image":
+				fmt.Fprintf(&bld, "<image id=\"%s\" />\n\n", block.ImageID)
+			case "p":
+				fmt.Fprintf(&bld, "%s\n\n", block.Text)
+			}
+		}
+
+		return bld.String()
+	default:
+		return ""
+	}
+}
+
+// InfoText returns the item's metadata and text in a human-readable format.
+func (i Item) InfoText() string {
+	bld := strings.Builder{}
+
+	fmt.Fprintf(&bld, "%s\n\n", i.URL())
+	fmt.Fprintf(&bld, "Title: %s\n", i.Title)
+	fmt.Fprintf(&bld, "Creator: %s (%s)\n", i.User.Name, i.CreatorID)
+	fmt.Fprintf(&bld, "Published: %s\n", time.Time(i.PublishedDateTime).Format(time.RFC3339))
+	fmt.Fprintf(&bld, "Updated: %s\n", time.Time(i.UpdatedDateTime).Format(time.RFC3339))
+
+	if len(i.Tags) > 0 {
+		fmt.Fprintf(&bld, "Tags: %s\n", strings.Join(i.Tags, ", "))
+	}
+
+	fmt.Fprintf(&bld, "Fee: %s\n", i.FeeString())
+
+	if i.RestrictedFor != "" {
+		fmt.Fprintf(&bld, "Restricted For: %s\n", i.RestrictedFor)
+	}
+
+	fmt.Fprintf(&bld, "Likes: %d\n", i.LikeCount)
+	fmt.Fprintf(&bld, "Comments: %d\n", i.CommentCount)
+
+	if text := i.Text(); text != "" {
+		fmt.Fprintf(&bld, "\n%s", text)
+	}
+
+	return bld.String()
+}
+
+type itemInfo struct {
+	ID                string    `json:"id"`
+	URL               string    `json:"url"`
+	Title             string    `json:"title"`
+	Type              ItemType  `json:"type"`
+	CreatorID         string    `json:"creatorId"`
+	User              User      `json:"user"`
+	PublishedDateTime time.Time `json:"publishedDatetime"`
+	UpdatedDateTime   time.Time `json:"updatedDatetime"`
+	Tags              []string  `json:"tags"`
+	FeeRequired       int       `json:"feeRequired"`
+	RestrictedFor     string    `json:"restrictedFor,omitempty"`
+	LikeCount         int       `json:"likeCount"`
+	CommentCount      int       `json:"commentCount"`
+	Text              string    `json:"text"`
+}
+
+// InfoJSON returns the item's metadata and text as indented JSON.
+func (i Item) InfoJSON() ([]byte, error) {
+	return json.MarshalIndent(itemInfo{
+		ID:                i.ID,
+		URL:               i.URL(),
+		Title:             i.Title,
+		Type:              i.Type,
+		CreatorID:         i.CreatorID,
+		User:              i.User,
+		PublishedDateTime: time.Time(i.PublishedDateTime),
+		UpdatedDateTime:   time.Time(i.UpdatedDateTime),
+		Tags:              i.Tags,
+		FeeRequired:       i.FeeRequired,
+		RestrictedFor:     i.RestrictedFor,
+		LikeCount:         i.LikeCount,
+		CommentCount:      i.CommentCount,
+		Text:              i.Text(),
+	}, "", "\t")
+}
+
+// PreviewText returns the excerpt with its whitespace collapsed, truncated to
+// at most maxLen runes. A truncated excerpt is cut at a word boundary where
+// possible and ends with an ellipsis, which counts towards maxLen.
+func (ib ItemBase) PreviewText(maxLen int) string {
+	text := strings.Join(strings.Fields(ib.Excerpt), " ")
+
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+	if maxLen < 1 {
+		return ""
+	}
+
+	cut := runes[:maxLen-1]
+
+	// Back up to the last space if the cut is in the middle of a word. Text
+	// without spaces, such as Japanese, is cut at the rune instead.
+	if runes[maxLen-1] != ' ' {
+		for i := len(cut) - 1; i > 0; i-- {
+			if cut[i] == ' ' {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+
+	return strings.TrimRight(string(cut), " ,.;:") + "…"
+}
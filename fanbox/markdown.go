@@ -0,0 +1,65 @@
+package fanbox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Markdown renders the article as Markdown. Links in paragraphs are kept as
+// Markdown links, and images are linked to their original URLs.
+func (b *ArticleBody) Markdown() string {
+	bld := strings.Builder{}
+
+	for _, block := range b.Blocks {
+		switch block.Type {
+		case "p":
+			bld.WriteString(block.markdownText())
+			bld.WriteString("\n\n")
+		case "header":
+			fmt.Fprintf(&bld, "## %s\n\n", block.Text)
+		case "image":
+			if image, ok := b.ImageMap[block.ImageID]; ok {
+				fmt.Fprintf(&bld, "![%s](%s)\n\n", block.ImageID, image.OriginalURL)
+			} else {
+				fmt.Fprintf(&bld, "<image id=\"%s\" />\n\n", block.ImageID)
+			}
+		}
+	}
+
+	return bld.String()
+}
+
+// markdownText returns the block's text with its links as Markdown links.
+func (block ArticleBodyBlock) markdownText() string {
+	if len(block.Links) == 0 {
+		return block.Text
+	}
+
+	links := append([]BlockLink(nil), block.Links...)
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Offset < links[j].Offset
+	})
+
+	text := utf16.Encode([]rune(block.Text))
+	bld := strings.Builder{}
+	last := 0
+
+	for _, link := range links {
+		start := link.Offset
+		end := link.Offset + link.Length
+
+		// Skip invalid or overlapping links.
+		if start < last || end > len(text) || link.Length <= 0 {
+			continue
+		}
+
+		bld.WriteString(string(utf16.Decode(text[last:start])))
+		fmt.Fprintf(&bld, "[%s](%s)", string(utf16.Decode(text[start:end])), link.URL)
+		last = end
+	}
+
+	bld.WriteString(string(utf16.Decode(text[last:])))
+	return bld.String()
+}
@@ -0,0 +1,119 @@
+package fanbox
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotLoggedIn is returned when the session is not logged in, which usually
+// means that the session ID has expired.
+var ErrNotLoggedIn = errors.New("session is not logged in")
+
+var metadataRegex = regexp.MustCompile(`<meta name="metadata" content='([^']*)'`)
+
+// pageMetadata is the metadata embedded into the HTML page of the website.
+type pageMetadata struct {
+	CSRFToken string `json:"csrfToken"`
+	Context   struct {
+		User struct {
+			IsLoggedIn bool   `json:"isLoggedIn"`
+			UserID     string `json:"userId"`
+			Name       string `json:"name"`
+			IconURL    string `json:"iconUrl"`
+		} `json:"user"`
+	} `json:"context"`
+}
+
+func (s *Session) fetchMetadata() (*pageMetadata, error) {
+	r, err := s.do(context.Background(), "GET", OriginURL, nil, http.Header{
+		"Accept": {"text/html"},
+	}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get page")
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read page")
+	}
+
+	matches := metadataRegex.FindSubmatch(b)
+	if matches == nil {
+		return nil, errors.New("no metadata found in page")
+	}
+
+	var metadata pageMetadata
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(matches[1]))), &metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to decode metadata")
+	}
+
+	return &metadata, nil
+}
+
+// Me returns the user that the session is logged in as. ErrNotLoggedIn is
+// returned if the session is not logged in.
+func (s *Session) Me() (*User, error) {
+	metadata, err := s.fetchMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	u := metadata.Context.User
+	if !u.IsLoggedIn {
+		return nil, ErrNotLoggedIn
+	}
+
+	return &User{
+		UserID:  u.UserID,
+		Name:    u.Name,
+		IconURL: u.IconURL,
+	}, nil
+}
+
+// Validate returns nil if the session is logged in.
+func (s *Session) Validate() error {
+	_, err := s.Me()
+	return err
+}
+
+// StartKeepalive starts validating the session every interval in the
+// background until ctx is done, which also keeps the session warm. onExpire
+// is called with the error once the session is found to be logged out or
+// rejected; other errors, such as network ones, are ignored. Nothing is
+// started if interval is not positive.
+func (s *Session) StartKeepalive(ctx context.Context, interval time.Duration, onExpire func(error)) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := asAuthError(s.Validate())
+			if err == nil {
+				continue
+			}
+
+			var authErr *AuthError
+			if errors.Is(err, ErrNotLoggedIn) || errors.As(err, &authErr) {
+				onExpire(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package fanbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// NewMockSession creates a new session that never hits the network. Instead,
+// its transport serves the JSON responses that were dumped into dir using
+// WithResponseDump. Requests to URLs without a dump are answered with 404.
+func NewMockSession(dir string, opts ...Option) *Session {
+	sc := NewSessionClient(opts...)
+	sc.Client.Transport = dumpTransport{dir}
+
+	return &Session{SessionClient: sc, csrf: &csrfCache{}, creators: &creatorIDCache{}}
+}
+
+type dumpTransport struct {
+	dir string
+}
+
+func (t dumpTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(t.dir, DumpFilename(r.URL.String())))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read response dump")
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		code = http.StatusNotFound
+		b = []byte("no response dump for " + r.URL.String())
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       r,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// NamedReader is a download along with the file name suggested for it.
+type NamedReader struct {
+	io.ReadCloser
+	Name string
+}
+
+// DownloadAll starts downloading every image in the body at once. The returned
+// map is keyed by image ID, and each reader is named by the image's ID and
+// extension. The caller must close all readers.
+func (ib *ImageBody) DownloadAll(s *Session) (map[string]NamedReader, error) {
+	readers := make(map[string]NamedReader, len(ib.Images))
+
+	for _, image := range ib.Images {
+		r, err := s.DownloadResumable(image.OriginalURL)
+		if err != nil {
+			for _, r := range readers {
+				r.Close()
+			}
+			return nil, errors.Wrapf(err, "failed to download image %s", image.ID)
+		}
+
+		readers[image.ID] = NamedReader{
+			ReadCloser: r,
+			Name:       image.Filename(),
+		}
+	}
+
+	return readers, nil
+}
+
+// DownloadNamed downloads the file at url and returns its body along with a
+// file name for it. The name is the last element of the URL's path, and its
+// extension is taken from the URL, then from the Content-Type header, then
+// from the first bytes of the body.
+func (sc *SessionClient) DownloadNamed(fileURL string) (io.ReadCloser, string, error) {
+	return sc.downloadNamed(context.Background(), fileURL, urlFileName(fileURL))
+}
+
+// urlFileName returns the last element of the URL's path, without the query
+// string or fragment.
+func urlFileName(fileURL string) string {
+	if u, err := url.Parse(fileURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(fileURL)
+}
+
+// downloadNamed downloads the file at url and appends an extension to name if
+// it has none, as described in DownloadNamed.
+func (sc *SessionClient) downloadNamed(ctx context.Context, url, name string) (io.ReadCloser, string, error) {
+	r, err := sc.DownloadResumableContext(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if path.Ext(name) != "" {
+		return r, name, nil
+	}
+
+	if ext := extensionByType(responseHeader(r).Get("Content-Type")); ext != "" {
+		return r, name + "." + ext, nil
+	}
+
+	ext, sniffed, err := SniffExtension(r)
+	if err != nil {
+		r.Close()
+		return nil, "", errors.Wrap(err, "failed to sniff extension")
+	}
+
+	if ext != "" {
+		name += "." + ext
+	}
+
+	return readCloser{sniffed, r}, name, nil
+}
+
+// readCloser combines a reader with the closer of another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseHeader returns the response header of a body returned by
+// downloadNamed or DownloadResumable, or an empty header if it is unknown.
+func responseHeader(r io.ReadCloser) http.Header {
+	if rc, ok := r.(readCloser); ok {
+		r, _ = rc.Closer.(io.ReadCloser)
+	}
+
+	if rr, ok := r.(*resumableReader); ok {
+		return rr.header
+	}
+
+	return http.Header{}
+}
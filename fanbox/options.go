@@ -0,0 +1,135 @@
+package fanbox
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Option is an option that configures a SessionClient when it is constructed.
+type Option func(sc *SessionClient)
+
+// WithResponseDump makes the client write every raw JSON response into dir.
+// Each file is named after a hash of the request URL; see DumpFilename.
+func WithResponseDump(dir string) Option {
+	return func(sc *SessionClient) {
+		sc.DumpDir = dir
+	}
+}
+
+// WithAcceptLanguage makes the client request content in the given language,
+// such as "ja" or "en-US".
+func WithAcceptLanguage(lang string) Option {
+	return func(sc *SessionClient) {
+		sc.AcceptLanguage = lang
+	}
+}
+
+// WithRequestModifier sets the RequestModifier of the client, which can change
+// every request before it is sent.
+func WithRequestModifier(modify func(*http.Request) error) Option {
+	return func(sc *SessionClient) {
+		sc.RequestModifier = modify
+	}
+}
+
+// WithClock makes the client use the given Clock for its delays instead of the
+// system time.
+func WithClock(clock Clock) Option {
+	return func(sc *SessionClient) {
+		sc.Clock = clock
+	}
+}
+
+// WithDownloadRateLimit caps the total speed of all downloads made using
+// Download to the given number of bytes per second. A zero value means
+// unlimited.
+func WithDownloadRateLimit(bytesPerSec int64) Option {
+	return func(sc *SessionClient) {
+		if bytesPerSec > 0 {
+			sc.downloadLimiter = newByteLimiter(bytesPerSec)
+		} else {
+			sc.downloadLimiter = nil
+		}
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle connections kept
+// per host. Increasing it helps when downloading many files from the same CDN
+// host concurrently.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(sc *SessionClient) {
+		sc.transport().MaxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets the maximum amount of time an idle connection is
+// kept in the pool before being closed.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(sc *SessionClient) {
+		sc.transport().IdleConnTimeout = d
+	}
+}
+
+// WithTLSConfig makes the client's transport use the given TLS configuration,
+// such as one with a custom RootCAs pool for networks behind a MITM proxy.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(sc *SessionClient) {
+		sc.transport().TLSClientConfig = cfg
+	}
+}
+
+// WithTimeout sets the overall timeout of a request, including reading the
+// whole response body. It defaults to 15 minutes; 0 means no timeout, which
+// suits very large downloads when combined with the other timeouts.
+func WithTimeout(d time.Duration) Option {
+	return func(sc *SessionClient) {
+		sc.Client.Timeout = d
+	}
+}
+
+// WithDialTimeout sets the maximum amount of time to wait for a connection to
+// be established.
+func WithDialTimeout(d time.Duration) Option {
+	return func(sc *SessionClient) {
+		dialer := &net.Dialer{
+			Timeout:   d,
+			KeepAlive: 30 * time.Second,
+		}
+		sc.transport().DialContext = dialer.DialContext
+	}
+}
+
+// WithTLSHandshakeTimeout sets the maximum amount of time to wait for a TLS
+// handshake.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(sc *SessionClient) {
+		sc.transport().TLSHandshakeTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout sets the maximum amount of time to wait for the
+// response headers after the request is sent. It does not limit reading the
+// body.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(sc *SessionClient) {
+		sc.transport().ResponseHeaderTimeout = d
+	}
+}
+
+// transport returns the client's transport to be configured. If the client
+// still uses the default transport, then a copy of it is made.
+func (sc *SessionClient) transport() *http.Transport {
+	switch t := sc.Client.Transport.(type) {
+	case *http.Transport:
+		return t
+	case nil:
+		clone := http.DefaultTransport.(*http.Transport).Clone()
+		sc.Client.Transport = clone
+		return clone
+	default:
+		panic(fmt.Sprintf("fanbox: cannot configure transport of type %T", t))
+	}
+}
@@ -0,0 +1,173 @@
+package fanbox
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pager iterates over pages of posts by following their NextURL.
+//
+// The list endpoints do not return the total number of posts or pages, so the
+// completion of an exhaustive fetch cannot be computed ahead of time. Fetched
+// can be used to report progress instead.
+type Pager struct {
+	session *Session
+	next    string
+	fetched int
+}
+
+// NewPager creates a new Pager that starts at the given URL, such as the first
+// page of a list endpoint.
+func (s *Session) NewPager(firstURL string) *Pager {
+	return &Pager{
+		session: s,
+		next:    firstURL,
+	}
+}
+
+// Next fetches the next page. It returns io.EOF once the last page has been
+// fetched.
+func (p *Pager) Next() (*Page, error) {
+	if p.next == "" {
+		return nil, io.EOF
+	}
+
+	page, err := p.session.PostsFromURL(p.next)
+	if err != nil {
+		return nil, err
+	}
+
+	p.next = page.Body.NextURL
+	p.fetched++
+
+	return page, nil
+}
+
+// Fetched returns the number of pages fetched so far.
+func (p *Pager) Fetched() int {
+	return p.fetched
+}
+
+// MergePages concatenates the items of all given pages into a single feed.
+// Items with the same ID are only included once, and the result is sorted by
+// PublishedDateTime with the newest item first.
+func MergePages(pages ...*Page) []Item {
+	var items []Item
+	seen := make(map[string]struct{})
+
+	for _, page := range pages {
+		if page == nil {
+			continue
+		}
+
+		for _, item := range page.Body.Items {
+			if _, ok := seen[item.ID]; ok {
+				continue
+			}
+
+			seen[item.ID] = struct{}{}
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		ti := time.Time(items[i].PublishedDateTime)
+		tj := time.Time(items[j].PublishedDateTime)
+		return ti.After(tj)
+	})
+
+	return items
+}
+
+// Creators returns the distinct users who created the given items, in the
+// order that they first appear.
+func Creators(items []Item) []User {
+	var users []User
+	seen := make(map[string]struct{})
+
+	for _, item := range items {
+		if _, ok := seen[item.User.UserID]; ok {
+			continue
+		}
+
+		seen[item.User.UserID] = struct{}{}
+		users = append(users, item.User)
+	}
+
+	return users
+}
+
+// FilterByType returns a copy of the page with only the items of the given
+// types. The NextURL is kept as-is. The API has no parameter to filter by
+// type, so filtering can only be done after the page is fetched.
+func (p *Page) FilterByType(types ...ItemType) *Page {
+	filtered := *p
+	filtered.Body.Items = make([]Item, 0, len(p.Body.Items))
+
+	for _, item := range p.Body.Items {
+		for _, typ := range types {
+			if item.Type == typ {
+				filtered.Body.Items = append(filtered.Body.Items, item)
+				break
+			}
+		}
+	}
+
+	return &filtered
+}
+
+// FileExtensions returns the distinct extensions of the files in the page,
+// sorted, such as ["pdf", "psd", "zip"]. Images are not included. It helps
+// choosing the AllowFileExts of an Archiver.
+func (p *Page) FileExtensions() []string {
+	seen := make(map[string]struct{})
+
+	add := func(ext string) {
+		if ext != "" {
+			seen[strings.ToLower(ext)] = struct{}{}
+		}
+	}
+
+	for _, item := range p.Body.Items {
+		switch body := item.Body.(type) {
+		case *FileBody:
+			for _, file := range body.Files {
+				add(file.Extension)
+			}
+		case *ArticleBody:
+			for _, file := range body.FileMap {
+				add(file.Extension)
+			}
+		}
+	}
+
+	exts := make([]string, 0, len(seen))
+	for ext := range seen {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	return exts
+}
+
+// DiffPages returns the items in newPage that are not in oldPage, compared by
+// ID, in the order of newPage. oldPage may be nil.
+func DiffPages(oldPage, newPage *Page) []Item {
+	seen := make(map[string]struct{})
+	if oldPage != nil {
+		for _, item := range oldPage.Body.Items {
+			seen[item.ID] = struct{}{}
+		}
+	}
+
+	var items []Item
+	for _, item := range newPage.Body.Items {
+		if _, ok := seen[item.ID]; !ok {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,113 @@
+package fanbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// DownloadParallel downloads the file at url into w by splitting it into the
+// given number of byte ranges and fetching them concurrently. If the server
+// does not support Range requests or does not tell the size, then the file is
+// downloaded as a single stream instead. An error is returned if the written
+// size does not match the Content-Length.
+func (sc *SessionClient) DownloadParallel(url string, w io.WriterAt, chunks int) error {
+	r, err := sc.head(url)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return &StatusError{StatusCode: r.StatusCode}
+	}
+
+	size := r.ContentLength
+
+	if chunks < 2 || size <= 0 || r.Header.Get("Accept-Ranges") != "bytes" {
+		return sc.downloadSingle(url, w, size)
+	}
+
+	chunkSize := (size + int64(chunks) - 1) / int64(chunks)
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	for start := int64(0); start < size; start += chunkSize {
+		start := start
+		end := start + chunkSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		g.Go(func() error {
+			return sc.downloadRange(ctx, url, w, start, end)
+		})
+	}
+
+	return g.Wait()
+}
+
+// downloadSingle downloads the whole file at url into w. size is the expected
+// size, or -1 if it is unknown.
+func (sc *SessionClient) downloadSingle(url string, w io.WriterAt, size int64) error {
+	body, err := sc.DownloadResumable(url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	n, err := io.Copy(&offsetWriter{w: w}, body)
+	if err != nil {
+		return errors.Wrap(err, "failed to download")
+	}
+
+	if size >= 0 && n != size {
+		return fmt.Errorf("downloaded %d bytes, expected %d", n, size)
+	}
+
+	return nil
+}
+
+// downloadRange downloads the inclusive byte range [start, end] of the file at
+// url into the same offsets of w.
+func (sc *SessionClient) downloadRange(ctx context.Context, url string, w io.WriterAt, start, end int64) error {
+	resp, err := sc.doResponse(ctx, "GET", url, nil, http.Header{
+		"Range": {fmt.Sprintf("bytes=%d-%d", start, end)},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to request range %d-%d", start, end)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	body := sc.throttle(ctx, resp.Body)
+
+	n, err := io.Copy(&offsetWriter{w: w, offset: start}, body)
+	if err != nil {
+		return errors.Wrapf(err, "failed to download range %d-%d", start, end)
+	}
+
+	if want := end - start + 1; n != want {
+		return fmt.Errorf("downloaded %d bytes of range %d-%d, expected %d", n, start, end, want)
+	}
+
+	return nil
+}
+
+// offsetWriter writes sequentially into an io.WriterAt from an offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(b []byte) (int, error) {
+	n, err := w.w.WriteAt(b, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,139 @@
+package fanbox
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Plan is a support plan, or tier, of a creator.
+type Plan struct {
+	ID              string `json:"id"`
+	Title           string `json:"title"`
+	Fee             int    `json:"fee"`
+	Description     string `json:"description"`
+	CoverImageURL   string `json:"coverImageUrl"`
+	User            User   `json:"user"`
+	CreatorID       string `json:"creatorId"`
+	HasAdultContent bool   `json:"hasAdultContent"`
+	PaymentMethod   string `json:"paymentMethod"`
+	// Rewards is the list of perks that the plan includes, if the API returns
+	// them. The Description usually describes them as well.
+	Rewards []PlanReward `json:"rewards,omitempty"`
+	// Currency is the currency of Fee. See ItemBase.Currency.
+	Currency string `json:"currency,omitempty"`
+}
+
+// FeeString returns the formatted fee, such as "¥500".
+func (p Plan) FeeString() string {
+	return formatFee(p.Fee, p.Currency)
+}
+
+// PlanReward is a perk included in a Plan.
+type PlanReward struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// SupportingPlans returns the plans that the user is currently supporting.
+func (s *Session) SupportingPlans() ([]Plan, error) {
+	return s.plans(APIEndpoint("/plan.listSupporting", nil))
+}
+
+// CreatorPlans returns all plans of the given creator.
+func (s *Session) CreatorPlans(creatorID string) ([]Plan, error) {
+	v := url.Values{
+		"creatorId": {creatorID},
+	}
+
+	return s.plans(APIEndpoint("/plan.listCreator", v))
+}
+
+func (s *Session) plans(url string) ([]Plan, error) {
+	var resp struct {
+		Body []Plan `json:"body"`
+	}
+
+	if err := s.Get(url, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// SupportingCreatorsTTL is how long SupportingCreatorIDs caches the creator IDs
+// for. 0 disables the cache.
+var SupportingCreatorsTTL = 10 * time.Minute
+
+// creatorIDCache caches the IDs of the creators that a session supports.
+type creatorIDCache struct {
+	mu      sync.Mutex
+	ids     []string
+	fetched time.Time
+}
+
+// SupportingCreatorIDs returns the IDs of the creators that the user is
+// supporting, in the order of SupportingPlans. The IDs are cached for
+// SupportingCreatorsTTL; see RefreshSupportingCreatorIDs.
+func (s *Session) SupportingCreatorIDs() ([]string, error) {
+	if s.creators == nil || SupportingCreatorsTTL <= 0 {
+		return s.fetchSupportingCreatorIDs()
+	}
+
+	s.creators.mu.Lock()
+	defer s.creators.mu.Unlock()
+
+	if s.creators.ids != nil && time.Since(s.creators.fetched) < SupportingCreatorsTTL {
+		return append([]string(nil), s.creators.ids...), nil
+	}
+
+	return s.refreshSupportingCreatorIDs()
+}
+
+// RefreshSupportingCreatorIDs is like SupportingCreatorIDs, except the IDs are
+// always fetched again, and the cache is updated.
+func (s *Session) RefreshSupportingCreatorIDs() ([]string, error) {
+	if s.creators == nil {
+		return s.fetchSupportingCreatorIDs()
+	}
+
+	s.creators.mu.Lock()
+	defer s.creators.mu.Unlock()
+
+	return s.refreshSupportingCreatorIDs()
+}
+
+// refreshSupportingCreatorIDs fetches the IDs into the cache. The cache must be
+// locked.
+func (s *Session) refreshSupportingCreatorIDs() ([]string, error) {
+	ids, err := s.fetchSupportingCreatorIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	s.creators.ids = ids
+	s.creators.fetched = time.Now()
+
+	return append([]string(nil), ids...), nil
+}
+
+func (s *Session) fetchSupportingCreatorIDs() ([]string, error) {
+	plans, err := s.SupportingPlans()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(plans))
+	seen := make(map[string]struct{}, len(plans))
+
+	for _, plan := range plans {
+		if _, ok := seen[plan.CreatorID]; ok {
+			continue
+		}
+
+		seen[plan.CreatorID] = struct{}{}
+		ids = append(ids, plan.CreatorID)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,96 @@
+package fanbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PollState is the state of a poller that is kept across restarts, so that it
+// can resume where it stopped instead of reprocessing pages.
+type PollState struct {
+	// LastPoll is the time that the last poll finished.
+	LastPoll time.Time `json:"lastPoll"`
+	// LastSeen maps creator IDs to the newest post seen of each creator.
+	LastSeen map[string]SeenPost `json:"lastSeen"`
+}
+
+// SeenPost is a post recorded in PollState.
+type SeenPost struct {
+	PostID            string    `json:"postId"`
+	PublishedDateTime time.Time `json:"publishedDatetime"`
+}
+
+// Load loads the poll state from the JSON file at path. The state is reset if
+// the file does not exist.
+func (ps *PollState) Load(path string) error {
+	*ps = PollState{}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read poll state file")
+	}
+
+	if err := json.Unmarshal(b, ps); err != nil {
+		return errors.Wrap(err, "failed to decode poll state file")
+	}
+
+	return nil
+}
+
+// Save atomically writes the poll state into the JSON file at path.
+func (ps *PollState) Save(path string) error {
+	b, err := json.Marshal(ps)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode poll state")
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), tmpFilename())
+
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrap(err, "failed to write tmp poll state file")
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to restore poll state tmp to dst")
+	}
+
+	return nil
+}
+
+// Seen returns true if the item is not newer than the newest post seen of its
+// creator.
+func (ps *PollState) Seen(item Item) bool {
+	last, ok := ps.LastSeen[item.CreatorID]
+	if !ok {
+		return false
+	}
+
+	return item.ID == last.PostID || !time.Time(item.PublishedDateTime).After(last.PublishedDateTime)
+}
+
+// Update records the newest post of each creator among the given items.
+func (ps *PollState) Update(items []Item) {
+	if ps.LastSeen == nil {
+		ps.LastSeen = make(map[string]SeenPost)
+	}
+
+	for _, item := range items {
+		if ps.Seen(item) {
+			continue
+		}
+
+		ps.LastSeen[item.CreatorID] = SeenPost{
+			PostID:            item.ID,
+			PublishedDateTime: time.Time(item.PublishedDateTime),
+		}
+	}
+}
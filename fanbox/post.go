@@ -0,0 +1,129 @@
+package fanbox
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// GetPost returns the post with the given ID along with its full body.
+func (s *Session) GetPost(postID string) (*Item, error) {
+	info, err := s.GetPostInfo(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info.Item, nil
+}
+
+// PostInfo is a post as returned by post.info, which also references the
+// neighboring posts of the same creator.
+type PostInfo struct {
+	Item
+	// NextPostID is the ID of the next newer post of the creator, or empty if
+	// this is the newest post.
+	NextPostID string
+	// PrevPostID is the ID of the next older post of the creator, or empty if
+	// this is the oldest post.
+	PrevPostID string
+}
+
+// UnmarshalJSON unmarshals the post along with its navigation references.
+func (info *PostInfo) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &info.Item); err != nil {
+		return err
+	}
+
+	type postRef struct {
+		ID string `json:"id"`
+	}
+
+	var nav struct {
+		NextPost *postRef `json:"nextPost"`
+		PrevPost *postRef `json:"prevPost"`
+	}
+
+	if err := json.Unmarshal(b, &nav); err != nil {
+		return errors.Wrap(err, "failed to unmarshal post navigation")
+	}
+
+	info.NextPostID = ""
+	if nav.NextPost != nil {
+		info.NextPostID = nav.NextPost.ID
+	}
+
+	info.PrevPostID = ""
+	if nav.PrevPost != nil {
+		info.PrevPostID = nav.PrevPost.ID
+	}
+
+	return nil
+}
+
+// GetPostInfo is like GetPost, but it also returns the IDs of the neighboring
+// posts, which lets a creator's timeline be walked one post at a time.
+func (s *Session) GetPostInfo(postID string) (*PostInfo, error) {
+	v := url.Values{
+		"postId": {postID},
+	}
+
+	var resp struct {
+		Body *PostInfo `json:"body"`
+	}
+
+	if err := s.Get(APIEndpoint("/post.info", v), &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Body == nil {
+		return nil, errors.New("post not found")
+	}
+
+	return resp.Body, nil
+}
+
+// PostBundle is a post along with everything about it.
+type PostBundle struct {
+	Item     *Item
+	Comments []Comment
+	// CommentsErr is the error that occurred while fetching the comments, if
+	// any. The rest of the bundle is still valid.
+	CommentsErr error
+	// DownloadURLs are the URLs of all images and files in the post.
+	DownloadURLs []string
+}
+
+// FetchPostBundle fetches the post with the given ID and its first page of
+// comments concurrently. An error is only returned if the post itself cannot
+// be fetched; failing to fetch the comments is recorded in the bundle.
+func (s *Session) FetchPostBundle(postID string) (*PostBundle, error) {
+	var bundle PostBundle
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		page, err := s.PostComments(postID, MaxLimit)
+		if err != nil {
+			bundle.CommentsErr = err
+			return
+		}
+
+		bundle.Comments = page.Body.Items
+	}()
+
+	item, err := s.GetPost(postID)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	bundle.Item = item
+	bundle.DownloadURLs = itemURLs(*item, func(File) bool { return true })
+
+	return &bundle, nil
+}
@@ -0,0 +1,82 @@
+package fanbox
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitStatus is the rate limit state that the server last reported
+// through the X-RateLimit headers.
+type RateLimitStatus struct {
+	// Limit is the number of requests allowed in the current window, or -1
+	// if it is unknown.
+	Limit int
+	// Remaining is the number of requests left in the current window, or -1
+	// if it is unknown.
+	Remaining int
+	// Reset is when the current window ends. It is zero if unknown.
+	Reset time.Time
+}
+
+// Known returns true if the server has reported the remaining requests.
+func (s RateLimitStatus) Known() bool {
+	return s.Remaining >= 0
+}
+
+// RateLimitStatus returns the rate limit that the server reported in the last
+// response that had the X-RateLimit headers. Remaining is -1 if no response
+// has had them yet.
+func (sc *SessionClient) RateLimitStatus() RateLimitStatus {
+	sc.rateMu.Lock()
+	defer sc.rateMu.Unlock()
+
+	if sc.rate == nil {
+		return RateLimitStatus{Limit: -1, Remaining: -1}
+	}
+	return *sc.rate
+}
+
+// updateRateLimit records the X-RateLimit headers of the response, if any.
+func (sc *SessionClient) updateRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	status := RateLimitStatus{Limit: -1, Remaining: remaining}
+
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		status.Limit = limit
+	}
+
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		// Servers send either a Unix timestamp or the seconds until the reset.
+		if reset > 1e9 {
+			status.Reset = time.Unix(reset, 0)
+		} else {
+			status.Reset = sc.clock().Now().Add(time.Duration(reset) * time.Second)
+		}
+	}
+
+	sc.rateMu.Lock()
+	sc.rate = &status
+	sc.rateMu.Unlock()
+}
+
+// waitRateLimit blocks until the rate limit window resets if the remaining
+// requests are at most RateLimitThreshold. It returns early if ctx is done.
+func (sc *SessionClient) waitRateLimit(ctx context.Context) {
+	if sc.RateLimitThreshold <= 0 {
+		return
+	}
+
+	status := sc.RateLimitStatus()
+	if !status.Known() || status.Remaining > sc.RateLimitThreshold || status.Reset.IsZero() {
+		return
+	}
+
+	clock := sc.clock()
+	clock.Sleep(ctx, status.Reset.Sub(clock.Now()))
+}
@@ -0,0 +1,132 @@
+package fanbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Report is the JSON report of an archiving call that is written into
+// ArchiveOptions.ReportDir, so that unattended runs can be audited.
+type Report struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Stats are the totals of the call.
+	Stats ArchiveResult `json:"stats"`
+	// Items are the posts that were processed, in the order that they were
+	// first processed in.
+	Items []ReportItem `json:"items"`
+	// Error is the error that the call returned, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// ReportItem is a post in a Report.
+type ReportItem struct {
+	PostID    string `json:"postId"`
+	CreatorID string `json:"creatorId"`
+	Title     string `json:"title"`
+	// Files are the outcomes of the post's files in the post's order. It is
+	// empty if the post was skipped because it is marked as downloaded in
+	// State.
+	Files []ReportFile `json:"files"`
+}
+
+// ReportFile is the outcome of a file in a Report. It is DownloadResult with
+// the error as a string.
+type ReportFile struct {
+	Index  int            `json:"index"`
+	URL    string         `json:"url"`
+	Path   string         `json:"path"`
+	Status DownloadStatus `json:"status"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// item returns the report item of the given post, adding it if needed.
+func (r *Report) item(item Item) *ReportItem {
+	for i := range r.Items {
+		if r.Items[i].PostID == item.ID {
+			return &r.Items[i]
+		}
+	}
+
+	r.Items = append(r.Items, ReportItem{
+		PostID:    item.ID,
+		CreatorID: item.CreatorID,
+		Title:     item.Title,
+		Files:     []ReportFile{},
+	})
+
+	return &r.Items[len(r.Items)-1]
+}
+
+// record records the outcome of a file, replacing the earlier outcome of a
+// retried file.
+func (r *Report) record(item Item, result DownloadResult) {
+	file := ReportFile{
+		Index:  result.Index,
+		URL:    result.URL,
+		Path:   result.Path,
+		Status: result.Status,
+	}
+	if result.Err != nil {
+		file.Error = result.Err.Error()
+	}
+
+	reportItem := r.item(item)
+
+	i := sort.Search(len(reportItem.Files), func(i int) bool {
+		return reportItem.Files[i].Index >= file.Index
+	})
+
+	if i < len(reportItem.Files) && reportItem.Files[i].Index == file.Index {
+		reportItem.Files[i] = file
+		return
+	}
+
+	reportItem.Files = append(reportItem.Files, ReportFile{})
+	copy(reportItem.Files[i+1:], reportItem.Files[i:])
+	reportItem.Files[i] = file
+}
+
+// startReport makes the run record a Report if ReportDir is set.
+func (a *Archiver) startReport(run *archiveRun) {
+	if a.ReportDir != "" {
+		run.summary = &Report{Started: time.Now()}
+	}
+}
+
+// finishReport writes the run's Report into ReportDir, if it has one. Errors
+// are logged, since the downloads themselves are done by now.
+func (a *Archiver) finishReport(run *archiveRun, err error) {
+	if run.summary == nil {
+		return
+	}
+
+	run.mu.Lock()
+	report := *run.summary
+	report.Stats = run.result
+	run.mu.Unlock()
+
+	report.Finished = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	b, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		log.Println("failed to encode report:", err)
+		return
+	}
+
+	name := "report-" + report.Started.UTC().Format("20060102T150405.000000000Z") + ".json"
+	path := filepath.Join(a.ReportDir, name)
+
+	if err := writeFile(a.storage(), path, bytes.NewReader(b), a.BufferSize); err != nil {
+		log.Println(errors.Wrap(err, "failed to write report"))
+	}
+}
@@ -0,0 +1,60 @@
+package fanbox
+
+// Embed is an external content embedded in an article, such as a video.
+type Embed struct {
+	ID              string `json:"id"`
+	ServiceProvider string `json:"serviceProvider"` // "youtube", "twitter", ...
+	ContentID       string `json:"contentId"`
+}
+
+// ResourceType is the type of a Resource.
+type ResourceType string
+
+const (
+	ResourceImage ResourceType = "image"
+	ResourceFile  ResourceType = "file"
+	ResourceEmbed ResourceType = "embed"
+)
+
+// Resource is an image, file or embed in an article. Only the field matching
+// Type is set.
+type Resource struct {
+	Type  ResourceType
+	Image *Image
+	File  *File
+	Embed *Embed
+}
+
+// Resources returns the images, files and embeds of the article in the order
+// that the blocks reference them. Resources that are missing from their map
+// only have their ID set.
+func (b *ArticleBody) Resources() []Resource {
+	var resources []Resource
+
+	for _, block := range b.Blocks {
+		switch block.Type {
+		case "image":
+			image, ok := b.ImageMap[block.ImageID]
+			if !ok {
+				image = Image{ID: block.ImageID}
+			}
+			resources = append(resources, Resource{Type: ResourceImage, Image: &image})
+
+		case "file":
+			file, ok := b.FileMap[block.FileID]
+			if !ok {
+				file = File{ID: block.FileID}
+			}
+			resources = append(resources, Resource{Type: ResourceFile, File: &file})
+
+		case "embed":
+			embed, ok := b.EmbedMap[block.EmbedID]
+			if !ok {
+				embed = Embed{ID: block.EmbedID}
+			}
+			resources = append(resources, Resource{Type: ResourceEmbed, Embed: &embed})
+		}
+	}
+
+	return resources
+}
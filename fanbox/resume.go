@@ -0,0 +1,99 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DownloadResumable is like Download, except the returned body transparently
+// recovers from read errors midway through the transfer. When reading fails,
+// the download is reissued as a Range request from the last successfully read
+// offset, up to Retries times.
+func (sc *SessionClient) DownloadResumable(url string) (io.ReadCloser, error) {
+	return sc.DownloadResumableContext(context.Background(), url)
+}
+
+// DownloadResumableContext is like DownloadResumable, except all requests are
+// canceled once ctx is done.
+func (sc *SessionClient) DownloadResumableContext(ctx context.Context, url string) (io.ReadCloser, error) {
+	resp, err := sc.doResponse(ctx, "GET", url, nil, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+
+	body := sc.throttle(ctx, resp.Body)
+
+	return &resumableReader{
+		ctx:    ctx,
+		sc:     sc,
+		url:    url,
+		header: resp.Header,
+		body:   body,
+	}, nil
+}
+
+type resumableReader struct {
+	ctx     context.Context
+	sc      *SessionClient
+	url     string
+	header  http.Header // of the first response
+	body    io.ReadCloser
+	offset  int64
+	resumed int
+}
+
+func (r *resumableReader) Read(b []byte) (int, error) {
+	for {
+		n, err := r.body.Read(b)
+		r.offset += int64(n)
+
+		if err == nil || err == io.EOF || r.resumed >= r.sc.Retries || r.ctx.Err() != nil {
+			return n, err
+		}
+
+		r.resumed++
+
+		if resumeErr := r.resume(); resumeErr != nil {
+			return n, errors.Wrapf(err, "failed to resume after %v", resumeErr)
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume reopens the download from the current offset.
+func (r *resumableReader) resume() error {
+	r.body.Close()
+
+	resp, err := r.sc.doResponse(r.ctx, "GET", r.url, nil, http.Header{
+		"Range": {"bytes=" + strconv.FormatInt(r.offset, 10) + "-"},
+	})
+	if err != nil {
+		return err
+	}
+
+	body := r.sc.throttle(r.ctx, resp.Body)
+
+	r.body = body
+
+	// The server ignored the Range header and sent the whole file, so skip
+	// what was already read.
+	if resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(ioutil.Discard, body, r.offset); err != nil {
+			return errors.Wrap(err, "failed to skip already read bytes")
+		}
+	}
+
+	return nil
+}
+
+func (r *resumableReader) Close() error {
+	return r.body.Close()
+}
@@ -1,6 +1,8 @@
 package fanbox
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,6 +10,10 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -30,21 +36,23 @@ var (
 // Session is a Pixiv user session. It is copyable.
 type Session struct {
 	*SessionClient
+	csrf     *csrfCache
+	creators *creatorIDCache
 }
 
-func New(sessionID string) *Session {
+func New(sessionID string, opts ...Option) *Session {
 	u, err := url.Parse(CookieURL)
 	if err != nil {
 		panic("FanboxDomain failed to parse: " + err.Error())
 	}
 
-	sc := NewSessionClient()
+	sc := NewSessionClient(opts...)
 	sc.Client.Jar.SetCookies(u, []*http.Cookie{
 		newCookie("privacy_policy_agreement", "2"),
 		newCookie("FANBOXSESSID", sessionID),
 	})
 
-	return &Session{sc}
+	return &Session{SessionClient: sc, csrf: &csrfCache{}, creators: &creatorIDCache{}}
 }
 
 func newCookie(k, v string) *http.Cookie {
@@ -60,59 +68,418 @@ func newCookie(k, v string) *http.Cookie {
 
 // Posts returns the first 10 posts in the homepage.
 func (s *Session) Posts() (*Page, error) {
-	return s.PostsFromURL(APIURL + "/post.listHome?limit=10")
+	return s.PostsN(10)
 }
 
+// PostsN returns the first limit posts in the homepage. The limit is clamped
+// to MaxLimit.
+func (s *Session) PostsN(limit int) (*Page, error) {
+	return s.listPosts("/post.listHome", limit)
+}
+
+// PostsFromURL returns the page of posts at the given URL, which is usually a
+// NextURL. An error is returned if the URL does not point to a Fanbox host, so
+// that the session is never sent elsewhere.
 func (s *Session) PostsFromURL(url string) (*Page, error) {
+	if err := checkHost(url); err != nil {
+		return nil, err
+	}
+
 	var page *Page
 	return page, s.Get(url, &page)
 }
 
+// checkHost returns an error if the given URL is not an HTTPS URL to Domain or
+// one of its subdomains.
+func checkHost(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse URL")
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("URL has unexpected scheme %q", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host != Domain && !strings.HasSuffix(host, "."+Domain) {
+		return fmt.Errorf("URL has foreign host %q", host)
+	}
+
+	return nil
+}
+
 // SupportingPosts returns the first 10 posts in the homepage, except it only
 // shows creators that the user is supporting.
 func (s *Session) SupportingPosts() (*Page, error) {
-	return s.PostsFromURL(APIURL + "/post.listSupporting?limit=10")
+	return s.SupportingPostsN(10)
+}
+
+// SupportingPostsN is like SupportingPosts, but it returns the first limit
+// posts. The limit is clamped to MaxLimit.
+func (s *Session) SupportingPostsN(limit int) (*Page, error) {
+	return s.listPosts("/post.listSupporting", limit)
+}
+
+// SupportingPostsPages returns the posts of up to maxPages pages of the
+// supporting feed, following NextURL from the first page. Posts that appear on
+// more than one page are only returned once.
+func (s *Session) SupportingPostsPages(maxPages int) ([]Item, error) {
+	pager := s.NewPager(APIEndpoint("/post.listSupporting", url.Values{
+		"limit": {strconv.Itoa(MaxLimit)},
+	}))
+
+	var pages []*Page
+
+	for len(pages) < maxPages {
+		page, err := pager.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrapf(err, "failed to get supporting posts page %d", len(pages))
+		}
+
+		pages = append(pages, page)
+	}
+
+	return MergePages(pages...), nil
+}
+
+// AllSupportingPosts calls handler for every post in the supporting feed,
+// following the pages until the last one. It stops early if handler returns
+// an error or ctx is done, in which case that error is returned.
+func (s *Session) AllSupportingPosts(ctx context.Context, handler func(Item) error) error {
+	pager := s.NewPager(APIEndpoint("/post.listSupporting", url.Values{
+		"limit": {strconv.Itoa(MaxLimit)},
+	}))
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := pager.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrapf(err, "failed to get supporting posts page %d", pager.Fetched())
+		}
+
+		for _, item := range page.Body.Items {
+			if err := handler(item); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// FollowingPosts returns the first limit posts in the homepage, except it only
+// shows creators that the user is following, including ones that are followed
+// for free. The limit is clamped to MaxLimit.
+func (s *Session) FollowingPosts(limit int) (*Page, error) {
+	return s.listPosts("/post.listFollowing", limit)
+}
+
+func (s *Session) listPosts(endpoint string, limit int) (*Page, error) {
+	limit, err := clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PostsFromURL(APIEndpoint(endpoint, url.Values{
+		"limit": {strconv.Itoa(limit)},
+	}))
+}
+
+// APIEndpoint returns the URL to the API endpoint at path, such as
+// "/post.listHome", with the given query parameters escaped. params may be nil.
+func APIEndpoint(path string, params url.Values) string {
+	u := APIURL + "/" + strings.TrimPrefix(path, "/")
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+// MaxLimit is the maximum number of items that Fanbox returns in one page.
+var MaxLimit = 300
+
+// clampLimit clamps the given page limit to MaxLimit. An error is returned if
+// the limit is not positive.
+func clampLimit(limit int) (int, error) {
+	if limit < 1 {
+		return 0, fmt.Errorf("invalid limit %d", limit)
+	}
+
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	return limit, nil
+}
+
+// TaggedPosts returns the first limit posts of the given creator that are
+// tagged with the given tag. The returned page's NextURL can be used with
+// PostsFromURL for continuation.
+func (s *Session) TaggedPosts(creatorID, tag string, limit int) (*Page, error) {
+	limit, err := clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{
+		"creatorId": {creatorID},
+		"tag":       {tag},
+		"limit":     {strconv.Itoa(limit)},
+	}
+
+	return s.PostsFromURL(APIEndpoint("/post.listTagged", v))
+}
+
+// PinnedPosts returns the posts that the given creator has pinned.
+func (s *Session) PinnedPosts(creatorID string) ([]Item, error) {
+	v := url.Values{
+		"creatorId": {creatorID},
+	}
+
+	return s.items(APIEndpoint("/post.listPinned", v))
+}
+
+// RelatedPosts returns the posts that Fanbox shows as related to the given
+// post. The items are full items, so their bodies can be downloaded as well.
+func (s *Session) RelatedPosts(postID string) ([]Item, error) {
+	v := url.Values{
+		"postId": {postID},
+	}
+
+	return s.items(APIEndpoint("/post.listRelated", v))
+}
+
+// items returns the items at the given URL, which responds with a plain list
+// of items instead of a page.
+func (s *Session) items(url string) ([]Item, error) {
+	var resp struct {
+		Body []Item `json:"body"`
+	}
+
+	if err := s.Get(url, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
 }
 
 // SessionClient contains methods to request with the required cookies.
 type SessionClient struct {
-	Client  *http.Client
+	Client *http.Client
+	// Retries is the number of times that a request is retried after a
+	// transient failure if RetryPolicy is nil. Writes that are safe to repeat,
+	// such as the JSON requests sent by postJSON, are retried like any other
+	// request. Other writes, such as AddComment, are only retried after 429
+	// Too Many Requests, so that they are never sent twice. See retryable.
 	Retries int
+	// HostIntervals maps a hostname to the minimum duration between the
+	// starts of two requests to that host. Hosts not in the map are not
+	// throttled. It must not be changed once requests are being made.
+	HostIntervals map[string]time.Duration
+	// DumpDir, if not empty, is the directory that every raw JSON response is
+	// written into.
+	DumpDir string
+	// AcceptLanguage, if not empty, is sent as the Accept-Language header.
+	AcceptLanguage string
+	// RequestModifier, if not nil, is called with every request after the
+	// standard headers are set, so that it can change the request, such as by
+	// adding headers for a proxy. The request is not sent if it returns an
+	// error. It is called again for each retry.
+	RequestModifier func(*http.Request) error
+	// RetryPolicy, if not nil, decides whether a failed request is retried
+	// instead of Retries. It is called after every failed attempt, starting
+	// from attempt 0, with either the response of a non-2xx status, whose
+	// body is already closed, or nil if the request itself failed. The
+	// request is retried after the returned delay.
+	RetryPolicy func(resp *http.Response, err error, attempt int) (retry bool, delay time.Duration)
+
+	// RateLimitThreshold, if positive, makes requests wait for the rate limit
+	// window to reset once the server reports at most this many remaining
+	// requests. See RateLimitStatus.
+	RateLimitThreshold int
+	// Clock, if not nil, is used for the retry delay, HostIntervals,
+	// RateLimitThreshold and WithDownloadRateLimit instead of the system
+	// time.
+	Clock Clock
+
+	limitMu  sync.Mutex
+	limiters map[string]*hostLimiter
+
+	rateMu sync.Mutex
+	rate   *RateLimitStatus
+
+	downloadLimiter *byteLimiter
 }
 
-func NewSessionClient() *SessionClient {
+func NewSessionClient(opts ...Option) *SessionClient {
 	jar, _ := cookiejar.New(nil)
 
-	return &SessionClient{
+	sc := &SessionClient{
 		Client: &http.Client{
 			Jar:     jar,
 			Timeout: 15 * time.Minute,
 		},
 		Retries: 0,
 	}
+
+	for _, opt := range opts {
+		opt(sc)
+	}
+
+	return sc
 }
 
 func (sc *SessionClient) Download(url string) (body io.ReadCloser, err error) {
-	return sc.get(url, http.Header{})
+	return sc.DownloadContext(context.Background(), url)
+}
+
+// DownloadContext is like Download, except the request, including reading the
+// body, is canceled once ctx is done.
+func (sc *SessionClient) DownloadContext(ctx context.Context, url string) (body io.ReadCloser, err error) {
+	body, err = sc.do(ctx, "GET", url, nil, http.Header{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.throttle(ctx, body), nil
 }
 
 func (sc *SessionClient) Get(url string, v interface{}) error {
-	r, err := sc.get(url, http.Header{
-		"Accept": {"application/json, text/plain, */*"},
-	})
+	_, err := sc.do(context.Background(), "GET", url, nil, http.Header{}, v)
+	return err
+}
+
+// Post sends a POST request with the given body and headers to the URL. If v
+// is not nil, then the JSON response is decoded into it.
+func (sc *SessionClient) Post(url string, body io.Reader, header http.Header, v interface{}) error {
+	return sc.post(context.Background(), url, body, header, v)
+}
+
+func (sc *SessionClient) post(ctx context.Context, url string, body io.Reader, header http.Header, v interface{}) error {
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Accept") == "" {
+		header.Set("Accept", "application/json, text/plain, */*")
+	}
+
+	r, err := sc.do(ctx, "POST", url, body, header, v)
+	if err != nil {
+		return err
+	}
+
+	if r != nil {
+		io.Copy(ioutil.Discard, r)
+		r.Close()
+	}
+
+	return nil
+}
+
+func (sc *SessionClient) decode(url string, r io.Reader, v interface{}) error {
+	if sc.DumpDir == "" {
+		if err := json.NewDecoder(r).Decode(v); err != nil {
+			return errors.Wrap(err, "failed to decode JSON")
+		}
+
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
+		return errors.Wrap(err, "failed to read body")
+	}
+
+	if err := dumpResponse(sc.DumpDir, url, b); err != nil {
 		return err
 	}
 
-	if err := json.NewDecoder(r).Decode(v); err != nil {
+	if err := json.Unmarshal(b, v); err != nil {
 		return errors.Wrap(err, "failed to decode JSON")
 	}
 
 	return nil
 }
 
-func (sc *SessionClient) get(url string, header http.Header) (body io.ReadCloser, err error) {
-	request, err := http.NewRequest("GET", url, nil)
+// Head performs a HEAD request to the given URL with the session's headers
+// and returns the status code. It can be used to cheaply check whether a URL
+// is reachable before downloading it.
+func (sc *SessionClient) Head(url string) (int, error) {
+	r, err := sc.head(url)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.StatusCode, nil
+}
+
+// ContentLength returns the size of the file at the given URL using a HEAD
+// request. -1 is returned if the server does not tell the size.
+func (sc *SessionClient) ContentLength(url string) (int64, error) {
+	r, err := sc.head(url)
+	if err != nil {
+		return 0, err
+	}
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return 0, &StatusError{StatusCode: r.StatusCode}
+	}
+
+	return r.ContentLength, nil
+}
+
+// LocalFileComplete returns true if the local file at path has the same size
+// as the remote file at url, which means that it is not truncated. It returns
+// false if the local file does not exist. If the server does not tell the
+// size, then an existing local file is assumed to be complete.
+func (sc *SessionClient) LocalFileComplete(url, path string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to stat local file")
+	}
+
+	remote, err := sc.ContentLength(url)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get remote size")
+	}
+
+	if remote < 0 {
+		return true, nil
+	}
+
+	return stat.Size() == remote, nil
+}
+
+func (sc *SessionClient) head(url string) (*http.Response, error) {
+	request, err := sc.newRequest(context.Background(), "HEAD", url, nil, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+
+	sc.waitHost(request.Context(), request.URL.Hostname())
+
+	r, err := sc.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to do request")
+	}
+	r.Body.Close()
+
+	return r, nil
+}
+
+func (sc *SessionClient) newRequest(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create request")
 	}
@@ -123,36 +490,215 @@ func (sc *SessionClient) get(url string, header http.Header) (body io.ReadCloser
 	request.Header.Set("User-Agent", UserAgent)
 	request.Header.Set("DNT", "1")
 
+	if sc.AcceptLanguage != "" {
+		request.Header.Set("Accept-Language", sc.AcceptLanguage)
+	}
+
+	if sc.RequestModifier != nil {
+		if err := sc.RequestModifier(request); err != nil {
+			return nil, errors.Wrap(err, "failed to modify request")
+		}
+	}
+
+	return request, nil
+}
+
+// do sends a request with the session's headers, retrying up to Retries times
+// on transient errors and status codes. If out is not nil, then the response is
+// decoded into it as JSON and the returned body is nil. Otherwise, the caller
+// must close the returned body.
+func (sc *SessionClient) do(ctx context.Context, method, url string, body io.Reader, header http.Header, out interface{}) (io.ReadCloser, error) {
+	if out != nil && header.Get("Accept") == "" {
+		header.Set("Accept", "application/json, text/plain, */*")
+	}
+
+	r, err := sc.doResponse(ctx, method, url, body, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if out == nil {
+		return r.Body, nil
+	}
+
+	defer r.Body.Close()
+	return nil, sc.decode(url, r.Body, out)
+}
+
+// doResponse is like do, except it returns the whole response.
+func (sc *SessionClient) doResponse(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
+	// Buffer the body so that it can be sent again on retries.
+	var b []byte
+	if body != nil {
+		var err error
+
+		b, err = ioutil.ReadAll(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read request body")
+		}
+	}
+
 	var r *http.Response
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(b)
+		}
+
+		var request *http.Request
+
+		request, err = sc.newRequest(ctx, method, url, reqBody, header.Clone())
+		if err != nil {
+			return nil, err
+		}
+
+		sc.waitHost(ctx, request.URL.Hostname())
+		sc.waitRateLimit(ctx)
 
-	for i := -1; i < sc.Retries; i++ {
 		r, err = sc.Do(request)
 		if err != nil {
 			err = errors.Wrap(err, "failed to do request")
-			continue
+			r = nil
+		} else {
+			sc.updateRateLimit(r.Header)
 		}
-		body = r.Body
 
-		if r.StatusCode < 200 || r.StatusCode > 299 {
-			var b []byte
-			b, err = ioutil.ReadAll(body)
+		if err == nil && (r.StatusCode < 200 || r.StatusCode > 299) {
+			errBody, readErr := ioutil.ReadAll(r.Body)
 			r.Body.Close()
 
-			if err != nil {
-				err = fmt.Errorf("unexpected status code %d", r.StatusCode)
-				continue
+			if readErr != nil {
+				errBody = nil
+			}
+
+			if isCloudflareChallenge(r.StatusCode, r.Header, errBody) {
+				return nil, errors.Wrapf(ErrCloudflareChallenge, "status code %d", r.StatusCode)
 			}
 
-			err = fmt.Errorf("unexpected status code %d, body %s", r.StatusCode, b)
-			continue
+			err = &StatusError{StatusCode: r.StatusCode, Body: errBody}
 		}
 
-		break
+		if err == nil || !sc.retry(ctx, method, r, err, attempt) {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
-	return
+	return r, nil
+}
+
+// retry returns true if the request that failed on the given attempt should be
+// retried, after waiting for the delay of RetryPolicy if any. Without a
+// RetryPolicy, only transient failures are retried up to Retries times; see
+// retryable.
+func (sc *SessionClient) retry(ctx context.Context, method string, resp *http.Response, err error, attempt int) bool {
+	if sc.RetryPolicy == nil {
+		return attempt < sc.Retries && retryable(method, resp, writeRetries(ctx))
+	}
+
+	retry, delay := sc.RetryPolicy(resp, err, attempt)
+	if !retry {
+		return false
+	}
+
+	sc.clock().Sleep(ctx, delay)
+	return true
+}
+
+// retryable returns true if a request with the given method that failed with
+// the given response, or nil if the request itself failed, may be retried.
+// Only request errors, 429 Too Many Requests and 5xx responses are transient;
+// other 4xx responses would fail the same way again. Since the server may
+// have processed a POST that failed with a request error or a 5xx, those are
+// only retried for 429, which is rejected before being processed, unless
+// retryWrites is true.
+func retryable(method string, resp *http.Response, retryWrites bool) bool {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !retryWrites && !idempotent(method) {
+		return false
+	}
+
+	return resp == nil || resp.StatusCode >= 500
+}
+
+type writeRetriesKey struct{}
+
+// withWriteRetries makes requests with the returned context retry writes on
+// every transient failure, for writes that are safe to repeat.
+func withWriteRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writeRetriesKey{}, true)
+}
+
+func writeRetries(ctx context.Context) bool {
+	retry, _ := ctx.Value(writeRetriesKey{}).(bool)
+	return retry
+}
+
+// idempotent returns true if requests with the given method can be safely
+// sent more than once.
+func idempotent(method string) bool {
+	switch method {
+	case "POST", "PATCH":
+		return false
+	default:
+		return true
+	}
 }
 
 func (sc *SessionClient) Do(r *http.Request) (*http.Response, error) {
 	return sc.Client.Do(r)
 }
+
+// waitHost blocks until a request to the given host is allowed according to
+// HostIntervals. It returns early if ctx is done.
+func (sc *SessionClient) waitHost(ctx context.Context, host string) {
+	every, ok := sc.HostIntervals[host]
+	if !ok || every <= 0 {
+		return
+	}
+
+	sc.limitMu.Lock()
+	l, ok := sc.limiters[host]
+	if !ok {
+		if sc.limiters == nil {
+			sc.limiters = make(map[string]*hostLimiter)
+		}
+		l = &hostLimiter{}
+		sc.limiters[host] = l
+	}
+	sc.limitMu.Unlock()
+
+	l.wait(ctx, sc.clock(), every)
+}
+
+type hostLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (l *hostLimiter) wait(ctx context.Context, clock Clock, every time.Duration) {
+	l.mu.Lock()
+
+	now := clock.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(every)
+
+	l.mu.Unlock()
+
+	clock.Sleep(ctx, at.Sub(now))
+}
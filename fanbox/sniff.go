@@ -0,0 +1,73 @@
+package fanbox
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sniffLen is the number of bytes that http.DetectContentType considers.
+const sniffLen = 512
+
+// contentTypeExts maps content types to their preferred extensions, because
+// mime.ExtensionsByType may return uncommon ones such as "jpe".
+var contentTypeExts = map[string]string{
+	"image/jpeg":      "jpg",
+	"image/png":       "png",
+	"image/gif":       "gif",
+	"image/webp":      "webp",
+	"image/bmp":       "bmp",
+	"video/mp4":       "mp4",
+	"video/webm":      "webm",
+	"audio/mpeg":      "mp3",
+	"audio/wave":      "wav",
+	"application/pdf": "pdf",
+	"application/zip": "zip",
+	"text/plain":      "txt",
+}
+
+// SniffExtension detects the file extension of the content read from r using
+// its first bytes. The extension is returned without the leading dot, or
+// empty if it cannot be determined. The returned reader replays the consumed
+// bytes followed by the rest of r.
+func SniffExtension(r io.Reader) (string, io.Reader, error) {
+	buf := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, errors.Wrap(err, "failed to read prefix")
+	}
+	buf = buf[:n]
+
+	ext := extensionByType(http.DetectContentType(buf))
+	return ext, io.MultiReader(bytes.NewReader(buf), r), nil
+}
+
+// extensionByType returns the extension without the leading dot of the given
+// content type, or an empty string if it is unknown.
+func extensionByType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	if ext, ok := contentTypeExts[mediaType]; ok {
+		return ext
+	}
+
+	// Don't guess anything for the catch-all type.
+	if mediaType == "application/octet-stream" {
+		return ""
+	}
+
+	exts, _ := mime.ExtensionsByType(mediaType)
+	if len(exts) == 0 {
+		return ""
+	}
+
+	return strings.TrimPrefix(exts[0], ".")
+}
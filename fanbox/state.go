@@ -0,0 +1,106 @@
+package fanbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// State keeps track of which posts have been fully downloaded, so that
+// archiving can resume without rescanning them. Implementations must be safe
+// to use concurrently.
+type State interface {
+	// Has returns true if the post with the given ID is fully downloaded.
+	Has(postID string) bool
+	// Mark marks the post with the given ID as fully downloaded.
+	Mark(postID string) error
+}
+
+// FileState is a State that is persisted as a JSON file.
+type FileState struct {
+	path string
+	mu   sync.Mutex
+	ids  map[string]struct{}
+}
+
+var _ State = (*FileState)(nil)
+
+// OpenFileState opens the JSON state file at the given path. If the file does
+// not exist, then an empty state is returned, and the file is created on the
+// first Mark.
+func OpenFileState(path string) (*FileState, error) {
+	s := &FileState{
+		path: path,
+		ids:  make(map[string]struct{}),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, errors.Wrap(err, "failed to read state file")
+	}
+
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, errors.Wrap(err, "failed to decode state file")
+	}
+
+	for _, id := range ids {
+		s.ids[id] = struct{}{}
+	}
+
+	return s, nil
+}
+
+// Has implements State.
+func (s *FileState) Has(postID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.ids[postID]
+	return ok
+}
+
+// Mark implements State. The whole state is written back to the file.
+func (s *FileState) Mark(postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.ids[postID]; ok {
+		return nil
+	}
+
+	s.ids[postID] = struct{}{}
+
+	ids := make([]string, 0, len(s.ids))
+	for id := range s.ids {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode state")
+	}
+
+	dir := filepath.Dir(s.path)
+	tmp := filepath.Join(dir, tmpFilename())
+
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrap(err, "failed to write tmp state file")
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to restore state tmp to dst")
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Storage is the destination that the Archiver writes files into. It allows
+// backends other than the local filesystem.
+type Storage interface {
+	// Create creates a writer for the file at path, creating any parent
+	// directories as needed. The file must only appear at path once the writer
+	// is closed without an error, so that partial files are never visible.
+	//
+	// When writing fails, Abort is called if the returned writer implements
+	// Aborter. Otherwise, the writer is left without being closed, since
+	// closing it would publish the partial file, so writers that hold
+	// resources should implement Aborter.
+	Create(path string) (io.WriteCloser, error)
+	// Exists returns true if a file exists at path.
+	Exists(path string) bool
+}
+
+// Aborter is implemented by writers returned by Storage that can discard what
+// was written so far.
+type Aborter interface {
+	Abort() error
+}
+
+// LocalStorage is a Storage on the local filesystem. Files are written into a
+// temporary file next to the destination, which is then renamed over it.
+type LocalStorage struct{}
+
+var _ Storage = LocalStorage{}
+
+// Create implements Storage.
+func (LocalStorage) Create(path string) (io.WriteCloser, error) {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "failed to mkdir -p")
+	}
+
+	tmp := filepath.Join(dir, tmpFilename())
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tmp file")
+	}
+
+	return &localFile{File: f, dst: path}, nil
+}
+
+// Exists implements Storage.
+func (LocalStorage) Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type localFile struct {
+	*os.File
+	dst string
+}
+
+func (f *localFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to close tmp file")
+	}
+
+	if err := os.Rename(f.Name(), f.dst); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to restore tmp to dst")
+	}
+
+	return nil
+}
+
+func (f *localFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// DefaultBufferSize is the size of the buffer that each download is copied to
+// storage through if ArchiveOptions.BufferSize is not set.
+const DefaultBufferSize = 32 * 1024
+
+// writeFile writes everything from r into path in the given storage, copying
+// through a buffer of bufSize bytes. Files are streamed, so the memory used
+// does not grow with their size.
+func writeFile(s Storage, path string, r io.Reader, bufSize int) error {
+	if bufSize <= 0 {
+		bufSize = DefaultBufferSize
+	}
+
+	w, err := s.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// Hide ReadFrom and WriteTo so that the copy always goes through our
+	// buffer instead of one chosen by the implementations.
+	buf := make([]byte, bufSize)
+	src := struct{ io.Reader }{r}
+	dst := struct{ io.Writer }{w}
+
+	if _, err := io.CopyBuffer(dst, src, buf); err != nil {
+		// Closing would publish the partial file, so writers that cannot
+		// abort are dropped instead.
+		if aborter, ok := w.(Aborter); ok {
+			aborter.Abort()
+		}
+		return errors.Wrap(err, "failed to copy to file")
+	}
+
+	return w.Close()
+}
+
+// DownloadToFile downloads the file at url into path on the local filesystem,
+// streaming it through a buffer of bufSize bytes, or DefaultBufferSize if not
+// positive. Like the Archiver, the file only appears at path once it is
+// complete.
+func (sc *SessionClient) DownloadToFile(ctx context.Context, url, path string, bufSize int) error {
+	r, err := sc.DownloadResumableContext(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return writeFile(LocalStorage{}, path, r, bufSize)
+}
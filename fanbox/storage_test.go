@@ -0,0 +1,151 @@
+package fanbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const largeFileSize = 64 << 20 // 64 MiB
+
+// zeroReader reads zeros forever.
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// roundTripFunc is an http.RoundTripper that calls itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// measureAlloc returns the number of bytes that f allocates.
+func measureAlloc(f func()) uint64 {
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// checkStreamed checks that a largeFileSize download allocated far less than
+// its size, and that the file at path has the whole content.
+func checkStreamed(t *testing.T, path string, alloc uint64) {
+	t.Helper()
+
+	if alloc > largeFileSize/16 {
+		t.Errorf("allocated %d bytes for a %d-byte file", alloc, largeFileSize)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("failed to stat file:", err)
+	}
+
+	if stat.Size() != largeFileSize {
+		t.Errorf("file has %d bytes, expected %d", stat.Size(), largeFileSize)
+	}
+}
+
+func TestWriteFileStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large")
+
+	var err error
+	alloc := measureAlloc(func() {
+		err = writeFile(LocalStorage{}, path, io.LimitReader(zeroReader{}, largeFileSize), 0)
+	})
+	if err != nil {
+		t.Fatal("failed to write file:", err)
+	}
+
+	checkStreamed(t, path, alloc)
+}
+
+func TestDownloadToFileStreams(t *testing.T) {
+	sc := NewSessionClient()
+	sc.Client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          ioutil.NopCloser(io.LimitReader(zeroReader{}, largeFileSize)),
+			ContentLength: largeFileSize,
+			Request:       r,
+		}, nil
+	})
+
+	path := filepath.Join(t.TempDir(), "large")
+	url := "https://downloads.fanbox.cc/files/post/1/large.bin"
+
+	var err error
+	alloc := measureAlloc(func() {
+		err = sc.DownloadToFile(context.Background(), url, path, 0)
+	})
+	if err != nil {
+		t.Fatal("failed to download file:", err)
+	}
+
+	checkStreamed(t, path, alloc)
+}
+
+// memoryStorage is a Storage that keeps files in memory. Its writers do not
+// implement Aborter.
+type memoryStorage map[string][]byte
+
+func (s memoryStorage) Create(path string) (io.WriteCloser, error) {
+	return &memoryFile{storage: s, path: path}, nil
+}
+
+func (s memoryStorage) Exists(path string) bool {
+	_, ok := s[path]
+	return ok
+}
+
+type memoryFile struct {
+	bytes.Buffer
+	storage memoryStorage
+	path    string
+}
+
+func (f *memoryFile) Close() error {
+	f.storage[f.path] = f.Bytes()
+	return nil
+}
+
+// errReader reads some bytes and then fails.
+type errReader struct{ read bool }
+
+func (r *errReader) Read(b []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("read failed")
+	}
+	r.read = true
+	return copy(b, "partial"), nil
+}
+
+func TestWriteFileFailedWithoutAborter(t *testing.T) {
+	storage := memoryStorage{}
+
+	if err := writeFile(storage, "file", &errReader{}, 0); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if storage.Exists("file") {
+		t.Errorf("partial file was published: %q", storage["file"])
+	}
+}
@@ -0,0 +1,115 @@
+package fanbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// StreamPosts is like PostsFromURL, except fn is called with each item as soon
+// as it is decoded instead of after the whole page is read, which keeps the
+// memory use of large pages low. Decoding stops at the first error returned
+// by fn, which is then returned. The response is not written into DumpDir.
+func (s *Session) StreamPosts(url string, fn func(Item) error) error {
+	if err := checkHost(url); err != nil {
+		return err
+	}
+
+	r, err := s.do(context.Background(), "GET", url, nil, http.Header{
+		"Accept": {"application/json, text/plain, */*"},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dec := json.NewDecoder(r)
+
+	var fnErr error
+
+	err = decodeObject(dec, func(key string) error {
+		if key != "body" {
+			return skipValue(dec)
+		}
+
+		return decodeObject(dec, func(key string) error {
+			if key != "items" {
+				return skipValue(dec)
+			}
+
+			if err := expectDelim(dec, '['); err != nil {
+				return err
+			}
+
+			for dec.More() {
+				var item Item
+				if err := dec.Decode(&item); err != nil {
+					return errors.Wrap(err, "failed to decode item")
+				}
+
+				if err := fn(item); err != nil {
+					fnErr = err
+					return err
+				}
+			}
+
+			return expectDelim(dec, ']')
+		})
+	})
+
+	if fnErr != nil {
+		return fnErr
+	}
+
+	return errors.Wrap(err, "failed to stream posts")
+}
+
+// decodeObject reads a JSON object from dec and calls fn with each key. fn
+// must consume the value of the key.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key %v", t)
+		}
+
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token from dec and returns an error if it is not
+// the given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if t != delim {
+		return fmt.Errorf("expected %v, got %v", delim, t)
+	}
+
+	return nil
+}
+
+// skipValue reads and discards the next value from dec.
+func skipValue(dec *json.Decoder) error {
+	var v json.RawMessage
+	return dec.Decode(&v)
+}
@@ -0,0 +1,73 @@
+package fanbox
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// byteLimiter limits the number of bytes read per second across all readers
+// that share it.
+type byteLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+func newByteLimiter(bytesPerSec int64) *byteLimiter {
+	return &byteLimiter{rate: bytesPerSec}
+}
+
+// wait blocks until n more bytes are allowed to have been read, or until ctx
+// is done.
+func (l *byteLimiter) wait(ctx context.Context, clock Clock, n int) {
+	l.mu.Lock()
+
+	now := clock.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	at := l.next
+
+	l.mu.Unlock()
+
+	clock.Sleep(ctx, at.Sub(now))
+}
+
+// throttle limits the speed of reading body according to
+// WithDownloadRateLimit. Waits are cut short once ctx is done.
+func (sc *SessionClient) throttle(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	if sc.downloadLimiter == nil {
+		return body
+	}
+
+	return throttledReader{
+		ReadCloser: body,
+		limiter:    sc.downloadLimiter,
+		ctx:        ctx,
+		clock:      sc.clock(),
+	}
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	limiter *byteLimiter
+	ctx     context.Context
+	clock   Clock
+}
+
+func (r throttledReader) Read(b []byte) (int, error) {
+	// Read at most a second's worth at once to keep the rate smooth.
+	if int64(len(b)) > r.limiter.rate {
+		b = b[:r.limiter.rate]
+	}
+
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.limiter.wait(r.ctx, r.clock, n)
+	}
+
+	return n, err
+}
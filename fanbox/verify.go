@@ -0,0 +1,118 @@
+package fanbox
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// MissingItem is a file of a post that is missing from or truncated in an
+// archive directory.
+type MissingItem struct {
+	Item Item
+	URL  string
+	Path string
+	// Size is the size of the file on disk, or -1 if it does not exist.
+	Size int64
+	// ExpectedSize is the size that the API reports for the file, or 0 if it
+	// is unknown, which is the case for images.
+	ExpectedSize int64
+}
+
+// Truncated returns true if the file exists but is smaller than expected.
+func (m MissingItem) Truncated() bool {
+	return m.Size >= 0
+}
+
+// VerifyArchive checks that every image and file in the page exists inside
+// the archive directory laid out with the default archive options. Files with
+// a known size are also checked to not be truncated.
+func VerifyArchive(page *Page, dir string) ([]MissingItem, error) {
+	a := Archiver{ArchiveOptions: DefaultArchiveOptions(), Dir: dir}
+	return a.VerifyPage(page)
+}
+
+// VerifyPage is like VerifyArchive, but it uses the archiver's directory and
+// options to find the downloaded files.
+func (a *Archiver) VerifyPage(page *Page) ([]MissingItem, error) {
+	var missing []MissingItem
+
+	for _, item := range page.Body.Items {
+		sizes := itemFileSizes(item)
+		run := &archiveRun{}
+		dir := a.ItemDir(item)
+
+		for i, url := range a.itemURLs(item) {
+			name, ok := run.claimName(dir, a.fileName(i, url), url)
+			if !ok {
+				continue
+			}
+
+			m := MissingItem{
+				Item:         item,
+				URL:          url,
+				Path:         filepath.Join(dir, name),
+				ExpectedSize: sizes[url],
+			}
+
+			size, err := localSize(m.Path)
+			if err != nil {
+				return missing, errors.Wrap(err, "failed to stat file")
+			}
+			m.Size = size
+
+			if m.Size < 0 || m.Size < m.ExpectedSize {
+				missing = append(missing, m)
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// localSize returns the size of the downloaded file at path, or -1 if it does
+// not exist. See findLocalFile.
+func localSize(path string) (int64, error) {
+	path, ok := findLocalFile(path)
+	if !ok {
+		return -1, nil
+	}
+
+	s, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.Size(), nil
+}
+
+// findLocalFile returns the path of the downloaded file at path, which may
+// have been given a sniffed extension if it had none.
+func findLocalFile(path string) (string, bool) {
+	if _, err := os.Stat(path); err == nil {
+		return path, true
+	}
+
+	if filepath.Ext(path) == "" {
+		matches, _ := filepath.Glob(globEscape(path) + ".*")
+		if len(matches) > 0 {
+			return matches[0], true
+		}
+	}
+
+	return "", false
+}
+
+// globEscape escapes the glob metacharacters in path.
+func globEscape(path string) string {
+	escaped := make([]rune, 0, len(path))
+	for _, r := range path {
+		switch r {
+		case '*', '?', '[', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return string(escaped)
+}
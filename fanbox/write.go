@@ -0,0 +1,84 @@
+package fanbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// postJSON sends v as the JSON body of a POST request to the given URL along
+// with the session's CSRF token. If out is not nil, then the JSON response is
+// decoded into it. If the server responds with 403 Forbidden,
+// then the token is fetched again and the request is retried once. An
+// *AuthError is returned if the server still rejects the session.
+//
+// Only transient failures, which are request errors, 429 Too Many Requests and
+// 5xx responses, are retried up to Retries times. 4xx responses never are. The
+// write must be safe to repeat; see postJSONOnce otherwise.
+func (s *Session) postJSON(url string, v, out interface{}) error {
+	return s.sendJSON(withWriteRetries(context.Background()), url, v, out)
+}
+
+// postJSONOnce is like postJSON, except the write is not retried after a
+// request error or a 5xx, since the server may have processed it already.
+func (s *Session) postJSONOnce(url string, v, out interface{}) error {
+	return s.sendJSON(context.Background(), url, v, out)
+}
+
+func (s *Session) sendJSON(ctx context.Context, url string, v, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode JSON")
+	}
+
+	err = s.postWithToken(ctx, url, b, out)
+	if isStatus(err, http.StatusForbidden) {
+		s.invalidateCSRFToken()
+		err = s.postWithToken(ctx, url, b, out)
+	}
+
+	return asAuthError(err)
+}
+
+func (s *Session) postWithToken(ctx context.Context, url string, body []byte, out interface{}) error {
+	token, err := s.csrfToken()
+	if err != nil {
+		return errors.Wrap(err, "failed to get CSRF token")
+	}
+
+	return s.post(ctx, url, bytes.NewReader(body), http.Header{
+		"Content-Type": {"application/json"},
+		"X-CSRF-Token": {token},
+	}, out)
+}
+
+// FollowCreator follows the creator with the given user ID (User.UserID).
+func (s *Session) FollowCreator(creatorUserID string) error {
+	return s.postJSON(APIEndpoint("/follow.create", nil), map[string]string{
+		"creatorUserId": creatorUserID,
+	}, nil)
+}
+
+// UnfollowCreator unfollows the creator with the given user ID.
+func (s *Session) UnfollowCreator(creatorUserID string) error {
+	return s.postJSON(APIEndpoint("/follow.delete", nil), map[string]string{
+		"creatorUserId": creatorUserID,
+	}, nil)
+}
+
+// LikePost likes the post with the given ID.
+func (s *Session) LikePost(postID string) error {
+	return s.postJSON(APIEndpoint("/post.like", nil), map[string]string{
+		"postId": postID,
+	}, nil)
+}
+
+// UnlikePost removes the like from the post with the given ID.
+func (s *Session) UnlikePost(postID string) error {
+	return s.postJSON(APIEndpoint("/post.unlike", nil), map[string]string{
+		"postId": postID,
+	}, nil)
+}
@@ -0,0 +1,98 @@
+package fanbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// xmpNamespace is the identifier that starts a JPEG APP1 segment holding XMP.
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/\x00"
+
+// XMPMetadata is the provenance metadata that EmbedXMP writes.
+type XMPMetadata struct {
+	Title     string
+	Creator   string
+	SourceURL string
+	Date      time.Time
+}
+
+// ItemXMPMetadata returns the XMP metadata describing the given item.
+func ItemXMPMetadata(item Item) XMPMetadata {
+	return XMPMetadata{
+		Title:     item.Title,
+		Creator:   item.User.Name,
+		SourceURL: item.URL(),
+		Date:      time.Time(item.PublishedDateTime),
+	}
+}
+
+// packet returns the XMP packet of the metadata.
+func (m XMPMetadata) packet() []byte {
+	esc := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+
+	return []byte(fmt.Sprintf(`<?xpacket begin="`+"\ufeff"+`" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about=""
+ xmlns:dc="http://purl.org/dc/elements/1.1/"
+ xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>
+<dc:source>%s</dc:source>
+<xmp:CreateDate>%s</xmp:CreateDate>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`,
+		esc(m.Title), esc(m.Creator), esc(m.SourceURL), m.Date.Format(time.RFC3339),
+	))
+}
+
+// EmbedXMP returns a reader that yields the JPEG image read from r with an XMP
+// segment containing the given metadata inserted. The segment is placed after
+// the JFIF header if there is one. An error is returned if r is not a JPEG.
+func EmbedXMP(r io.Reader, meta XMPMetadata) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(br, soi); err != nil {
+		return nil, errors.Wrap(err, "failed to read JPEG header")
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, errors.New("not a JPEG image")
+	}
+
+	var head bytes.Buffer
+	head.Write(soi)
+
+	// Keep the JFIF APP0 segment first, since it must follow SOI.
+	if marker, err := br.Peek(4); err == nil && marker[0] == 0xFF && marker[1] == 0xE0 {
+		length := int(binary.BigEndian.Uint16(marker[2:]))
+
+		if _, err := io.CopyN(&head, br, int64(2+length)); err != nil {
+			return nil, errors.Wrap(err, "failed to read JFIF segment")
+		}
+	}
+
+	payload := append([]byte(xmpNamespace), meta.packet()...)
+	if len(payload)+2 > 0xFFFF {
+		return nil, errors.New("XMP metadata is too large")
+	}
+
+	head.Write([]byte{0xFF, 0xE1})
+	binary.Write(&head, binary.BigEndian, uint16(len(payload)+2))
+	head.Write(payload)
+
+	return io.MultiReader(&head, br), nil
+}
@@ -0,0 +1,74 @@
+package fanbox
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ArchivePostToZip downloads all images and files of the given item into the
+// zip writer under the same creator/date: title/ path that the Archiver uses,
+// along with an info entry. Files are named like the Archiver names them, so
+// a file listed twice is only stored once, and files with the same name get a
+// suffix. The zip writer is not closed.
+func (s *Session) ArchivePostToZip(item Item, zw *zip.Writer) error {
+	dir := itemPath(item)
+	modified := time.Time(item.PublishedDateTime)
+
+	urls := itemURLs(item, func(File) bool { return true })
+	names := &archiveRun{}
+
+	for i, url := range urls {
+		name, ok := names.claimName(dir, fileName(i, url, false), url)
+		if !ok {
+			continue
+		}
+
+		if err := s.downloadToZip(zw, path.Join(dir, name), url, modified); err != nil {
+			return err
+		}
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     path.Join(dir, "info"),
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create info entry")
+	}
+
+	if _, err := io.Copy(w, strings.NewReader(item.InfoText())); err != nil {
+		return errors.Wrap(err, "failed to write info entry")
+	}
+
+	return nil
+}
+
+func (s *Session) downloadToZip(zw *zip.Writer, name, url string, modified time.Time) error {
+	r, err := s.Download(url)
+	if err != nil {
+		return errors.Wrap(err, "failed to download file")
+	}
+	defer r.Close()
+
+	// Images and videos are already compressed.
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create zip entry")
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return errors.Wrap(err, "failed to write zip entry")
+	}
+
+	return nil
+}
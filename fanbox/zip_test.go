@@ -0,0 +1,68 @@
+package fanbox
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestArchivePostToZipNames(t *testing.T) {
+	const post = `{
+		"id": "1",
+		"title": "Post",
+		"type": "image",
+		"creatorId": "creator",
+		"publishedDatetime": "2021-01-02T03:04:05+09:00",
+		"body": {
+			"images": [
+				{"id": "a", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/1/a.png"},
+				{"id": "a", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/1/a.png"},
+				{"id": "b", "extension": "png", "originalUrl": "https://downloads.fanbox.cc/images/post/2/a.png"}
+			]
+		}
+	}`
+
+	var item Item
+	if err := json.Unmarshal([]byte(post), &item); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+
+	s := New("session")
+	s.Client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(r.URL.Path))),
+			Request:    r,
+		}, nil
+	})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	if err := s.ArchivePostToZip(item, zw); err != nil {
+		t.Fatal("failed to archive:", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal("failed to close zip:", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("failed to read zip:", err)
+	}
+
+	names := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		names[i] = path.Base(f.Name)
+	}
+
+	if expected := []string{"a.png", "a (1).png", "info"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("entries = %q, expected %q", names, expected)
+	}
+}